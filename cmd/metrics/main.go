@@ -1,24 +1,53 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/health"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/metrics"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
 )
 
 func main() {
-	cfg, err := config.Load()
+	log := logging.For(logging.ComponentMetrics)
+
+	cfg, err := config.Load(config.ModeMetrics, os.Args[1:])
+	if config.IsHelp(err) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		logging.Fatal(log, "failed to load config", err)
+	}
+
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal(log, "failed to set up logging", err)
 	}
+	log = logging.For(logging.ComponentMetrics)
 
 	m, err := metrics.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create metrics collector: %v", err)
+		logging.Fatal(log, "failed to create metrics collector", err)
 	}
 
-	if err := m.Run(); err != nil {
-		log.Fatalf("Metrics collector failed: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	server := health.New(cfg, nil)
+	server.Handle("/metrics", telemetry.Handler())
+
+	go func() {
+		if err := server.Run(ctx); err != nil {
+			logging.Fatal(log, "metrics server failed", err)
+		}
+	}()
+
+	if err := m.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		logging.Fatal(log, "metrics collector failed", err)
 	}
 }
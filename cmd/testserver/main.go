@@ -1,24 +1,42 @@
 package main
 
 import (
-	"log"
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/server"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
 )
 
 func main() {
-	cfg, err := config.Load()
+	log := logging.For(logging.ComponentServer)
+
+	cfg, err := config.Load(config.ModeTestServer, os.Args[1:])
+	if config.IsHelp(err) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		logging.Fatal(log, "failed to load config", err)
 	}
 
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal(log, "failed to set up logging", err)
+	}
+	log = logging.For(logging.ComponentServer)
+
 	s, err := server.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create server: %v", err)
+		logging.Fatal(log, "failed to create server", err)
 	}
 
-	if err := s.Run(); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := s.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		logging.Fatal(log, "server failed", err)
 	}
 }
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/doctor"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// runDoctor checks the config, the clusters and the backend and prints the
+// results. It returns the exit status, which is 1 if any check failed.
+func runDoctor(args []string) int {
+	cfg, err := config.Load(config.ModeWatcher, args)
+	if config.IsHelp(err) {
+		return 0
+	}
+	if err != nil {
+		report := &doctor.Report{Results: []doctor.Result{{
+			Check:  "config",
+			Status: doctor.StatusFail,
+			Detail: strings.ReplaceAll(err.Error(), "\n", "; "),
+		}}}
+		report.Print(os.Stdout)
+		return 1
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	report := doctor.Run(ctx, cfg)
+	report.Print(os.Stdout)
+	if report.Failed() {
+		return 1
+	}
+	return 0
+}
@@ -2,24 +2,62 @@ package main
 
 import (
 	"context"
-	"log"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
 
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/health"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/watcher"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
 )
 
 func main() {
-	cfg, err := config.Load()
+	if len(os.Args) > 1 && os.Args[1] == "doctor" {
+		os.Exit(runDoctor(os.Args[2:]))
+	}
+
+	log := logging.For(logging.ComponentWatcher)
+
+	cfg, err := config.Load(config.ModeWatcher, os.Args[1:])
+	if config.IsHelp(err) {
+		return
+	}
 	if err != nil {
-		log.Fatalf("Failed to load config: %v", err)
+		logging.Fatal(log, "failed to load config", err)
+	}
+
+	if err := logging.Setup(cfg); err != nil {
+		logging.Fatal(log, "failed to set up logging", err)
 	}
+	log = logging.For(logging.ComponentWatcher)
 
 	w, err := watcher.New(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create watcher: %v", err)
+		logging.Fatal(log, "failed to create watcher", err)
 	}
 
-	if err := w.Run(context.Background()); err != nil {
-		log.Fatalf("Watcher failed: %v", err)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := telemetry.Registry.Register(w.Collector()); err != nil {
+		logging.Fatal(log, "failed to register watcher metrics", err)
+	}
+
+	server := health.New(cfg, w)
+	server.Handle("/metrics", telemetry.Handler())
+
+	go func() {
+		if err := server.Run(ctx); err != nil {
+			logging.Fatal(log, "health server failed", err)
+		}
+	}()
+
+	go config.Watch(ctx, cfg, os.Args[1:], log, w.Reload)
+
+	if err := w.Run(ctx); err != nil && !errors.Is(err, context.Canceled) {
+		logging.Fatal(log, "watcher failed", err)
 	}
 }
@@ -0,0 +1,269 @@
+// Package doctor checks that the watcher can run with its configuration:
+// the clusters are reachable, serve the APIs it uses and grant it the
+// access it needs, and the backend accepts its API key.
+package doctor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/watcher"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/kube"
+)
+
+// Status is the outcome of a check. A warning does not stop the watcher
+// from running but loses some data.
+type Status string
+
+const (
+	StatusPass Status = "PASS"
+	StatusWarn Status = "WARN"
+	StatusFail Status = "FAIL"
+)
+
+// Result is the outcome of one check
+type Result struct {
+	Check  string
+	Status Status
+	Detail string
+}
+
+// Report holds the results of every check, and the access found missing
+type Report struct {
+	Results []Result
+	missing []kube.Access
+}
+
+func (r *Report) add(check string, status Status, detail string) {
+	r.Results = append(r.Results, Result{Check: check, Status: status, Detail: detail})
+}
+
+// Failed reports whether any check failed
+func (r *Report) Failed() bool {
+	for _, result := range r.Results {
+		if result.Status == StatusFail {
+			return true
+		}
+	}
+	return false
+}
+
+// apis are the group versions whose absence is reported. Ingresses are
+// degraded on clusters without networking.k8s.io/v1; metrics.k8s.io is
+// only needed by the metrics collector.
+var apis = []struct {
+	groupVersion schema.GroupVersion
+	status       Status
+	purpose      string
+}{
+	{schema.GroupVersion{Version: "v1"}, StatusFail, "core resources"},
+	{schema.GroupVersion{Group: "apps", Version: "v1"}, StatusFail, "deployments and statefulsets"},
+	{schema.GroupVersion{Group: "networking.k8s.io", Version: "v1"}, StatusWarn, "ingresses"},
+	{schema.GroupVersion{Group: "metrics.k8s.io", Version: "v1beta1"}, StatusWarn, "resource usage metrics"},
+}
+
+// Run checks every cluster cfg watches and the backend
+func Run(ctx context.Context, cfg *config.Config) *Report {
+	report := &Report{}
+	report.add("config", StatusPass, "valid")
+
+	// With configured or secret clusters the home cluster only holds the
+	// lease and the secrets, it is not watched
+	requirements := watcher.Requirements(cfg)
+	if !watcher.MultiCluster(cfg) {
+		report.checkCluster(ctx, "", cfg.Kubernetes.Connection, requirements)
+	} else {
+		var home, watched []watcher.Requirement
+		for _, requirement := range requirements {
+			if requirement.Home {
+				home = append(home, requirement)
+			} else {
+				watched = append(watched, requirement)
+			}
+		}
+		report.checkCluster(ctx, "", cfg.Kubernetes.Connection, home)
+		for _, cluster := range cfg.Kubernetes.Clusters {
+			conn := cluster.Connection
+			if conn.Kubeconfig == "" && conn.Context != "" {
+				conn.Kubeconfig = cfg.Kubernetes.Kubeconfig
+			}
+			name := cluster.Name
+			if name == "" {
+				name = cluster.Context
+			}
+			report.checkCluster(ctx, name, conn, watched)
+		}
+	}
+
+	report.checkBackend(ctx, cfg)
+	return report
+}
+
+// checkCluster checks the connection to a cluster, the APIs it serves and
+// the access the agent has to them. The cluster the agent connects to
+// itself has no name.
+func (r *Report) checkCluster(ctx context.Context, name string, conn config.Connection, requirements []watcher.Requirement) {
+	prefix := ""
+	if name != "" {
+		prefix = name + ": "
+	}
+
+	restConfig, err := kube.RESTConfig(conn)
+	if err != nil {
+		r.add(prefix+"kubernetes config", StatusFail, err.Error())
+		return
+	}
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		r.add(prefix+"kubernetes client", StatusFail, err.Error())
+		return
+	}
+
+	version, err := client.Discovery().ServerVersion()
+	if err != nil {
+		r.add(prefix+"connect "+restConfig.Host, StatusFail, err.Error())
+		return
+	}
+	r.add(prefix+"connect "+restConfig.Host, StatusPass, "Kubernetes "+version.GitVersion)
+
+	for _, api := range apis {
+		check := prefix + "api " + api.groupVersion.String()
+		if _, err := client.Discovery().ServerResourcesForGroupVersion(api.groupVersion.String()); err != nil {
+			r.add(check, api.status, fmt.Sprintf("needed for %s: %v", api.purpose, err))
+			continue
+		}
+		r.add(check, StatusPass, "served")
+	}
+
+	for _, requirement := range requirements {
+		check := prefix + "rbac " + requirement.Access.String()
+		denied, err := kube.Denied(ctx, client, requirement.Access)
+		switch {
+		case err != nil:
+			r.add(check, StatusFail, err.Error())
+		case len(denied) > 0:
+			r.add(check, StatusFail, fmt.Sprintf("forbidden to %s, needed for %s", strings.Join(denied, " and "), requirement.Purpose))
+			missing := requirement.Access
+			missing.Verbs = denied
+			r.missing = append(r.missing, missing)
+		default:
+			r.add(check, StatusPass, requirement.Purpose)
+		}
+	}
+}
+
+// checkBackend makes a request to the backend with the API key. Any
+// response but an authentication failure or a server error passes; the
+// probe sends no events.
+func (r *Report) checkBackend(ctx context.Context, cfg *config.Config) {
+	check := "backend " + cfg.API.Server
+
+	ctx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, cfg.API.Server+"/api/v1/resources", nil)
+	if err != nil {
+		r.add(check, StatusFail, err.Error())
+		return
+	}
+	req.Header.Set("X-API-Key", cfg.API.Key)
+	req.Header.Set("User-Agent", "skyflo-kubernetes-agent")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		r.add(check, StatusFail, err.Error())
+		return
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		r.add(check, StatusFail, fmt.Sprintf("API key rejected (%s)", resp.Status))
+	case resp.StatusCode >= 500:
+		r.add(check, StatusWarn, "reachable but failing ("+resp.Status+")")
+	default:
+		r.add(check, StatusPass, "reachable ("+resp.Status+")")
+	}
+}
+
+// Print writes the results as a table, followed by the RBAC rules that
+// would grant the missing access
+func (r *Report) Print(w io.Writer) {
+	table := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(table, "CHECK\tSTATUS\tDETAIL")
+	for _, result := range r.Results {
+		fmt.Fprintf(table, "%s\t%s\t%s\n", result.Check, result.Status, result.Detail)
+	}
+	table.Flush()
+
+	if len(r.missing) > 0 {
+		fmt.Fprintln(w)
+		r.printRules(w)
+	}
+}
+
+// printRules suggests rules for the ClusterRole of the agent, and for a
+// Role in every namespace with namespaced access missing, in the format of
+// manifests/agent.yaml
+func (r *Report) printRules(w io.Writer) {
+	type ruleKey struct{ namespace, group, verbs string }
+	rules := make(map[ruleKey][]string)
+	for _, access := range r.missing {
+		key := ruleKey{access.Namespace, access.Resource.Group, strings.Join(access.Verbs, `", "`)}
+		if !contains(rules[key], access.Resource.Resource) {
+			rules[key] = append(rules[key], access.Resource.Resource)
+		}
+	}
+
+	keys := make([]ruleKey, 0, len(rules))
+	for key := range rules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.namespace != b.namespace {
+			return a.namespace < b.namespace
+		}
+		if a.group != b.group {
+			return a.group < b.group
+		}
+		return a.verbs < b.verbs
+	})
+
+	namespace := "-"
+	for _, key := range keys {
+		if key.namespace != namespace {
+			if namespace != "-" {
+				fmt.Fprintln(w)
+			}
+			namespace = key.namespace
+			if namespace == "" {
+				fmt.Fprintln(w, "Add these rules to the agent's ClusterRole:")
+			} else {
+				fmt.Fprintf(w, "Add these rules to a Role in namespace %s bound to the agent:\n", namespace)
+			}
+		}
+		fmt.Fprintf(w, "- apiGroups: [ %q ]\n", key.group)
+		fmt.Fprintf(w, "  resources: [ \"%s\" ]\n", strings.Join(rules[key], `", "`))
+		fmt.Fprintf(w, "  verbs: [ \"%s\" ]\n", key.verbs)
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
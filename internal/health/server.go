@@ -0,0 +1,100 @@
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/internal/watcher"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// Server exposes the probe endpoints of a watcher on config.Server.Host/Port:
+//
+//	/livez   200 while the watcher is running
+//	/readyz  200 once the home cluster, if watched, has shipped its
+//	         snapshot and the sender's circuit breaker is not open
+//	/healthz the full watcher.Health as JSON, with the /readyz status,
+//	         including the state of every cluster
+//
+// Further endpoints, such as /metrics, can be added with Handle. Without a
+// watcher, as in the metrics collector, the server only serves those.
+type Server struct {
+	cfg     *config.Config
+	watcher *watcher.Watcher
+	mux     *http.ServeMux
+}
+
+func New(cfg *config.Config, w *watcher.Watcher) *Server {
+	s := &Server{
+		cfg:     cfg,
+		watcher: w,
+		mux:     http.NewServeMux(),
+	}
+
+	if w != nil {
+		s.mux.HandleFunc("/livez", s.livez)
+		s.mux.HandleFunc("/readyz", s.readyz)
+		s.mux.HandleFunc("/healthz", s.healthz)
+	}
+	return s
+}
+
+// Handle registers an additional handler on the server
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run serves until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	server := &http.Server{
+		Addr:              net.JoinHostPort(s.cfg.Server.Host, strconv.Itoa(s.cfg.Server.Port)),
+		Handler:           s.mux,
+		ReadHeaderTimeout: s.cfg.Server.Timeout,
+	}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("failed to serve http endpoints: %w", err)
+	}
+	return nil
+}
+
+func (s *Server) livez(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, s.watcher.Health().Live)
+}
+
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	writeStatus(w, s.watcher.Health().Ready)
+}
+
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	health := s.watcher.Health()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !health.Ready {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(health)
+}
+
+func writeStatus(w http.ResponseWriter, ok bool) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if !ok {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintln(w, "not ok")
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
@@ -1,23 +1,300 @@
 package metrics
 
+import (
+	"sync"
+	"time"
+)
+
+// MetricsAggregator keeps the resource usage series of every node and pod
+// seen, dropping points older than retentionDays and all but the newest
+// maxPoints of each series, which bounds its memory. Pods are keyed by
+// namespace/name. Each source records the series it knows about, so
+// metrics.k8s.io and the kubelet fill different series of the same pod.
 type MetricsAggregator struct {
+	mu            sync.Mutex
 	nodeMetrics   map[string]*NodeMetrics
 	podMetrics    map[string]*PodMetrics
 	retentionDays int
+	maxPoints     int
 }
 
+// NodeMetrics holds the series of a node. CPU is in cores, Memory is the
+// working set in bytes, Disk the bytes used on the root filesystem and the
+// network series count the bytes received and sent since the node started.
 type NodeMetrics struct {
-	CPU    []MetricPoint
-	Memory []MetricPoint
-	Disk   []MetricPoint
+	CPU       []MetricPoint `json:"cpu,omitempty"`
+	Memory    []MetricPoint `json:"memory,omitempty"`
+	Disk      []MetricPoint `json:"disk,omitempty"`
+	NetworkRx []MetricPoint `json:"network_rx,omitempty"`
+	NetworkTx []MetricPoint `json:"network_tx,omitempty"`
 }
 
+// PodMetrics holds the series of a pod, in the units of NodeMetrics. CPU
+// and Memory are summed over its containers; EphemeralStorage is the local
+// storage its containers and emptyDir volumes use. Volumes are keyed by
+// volume name and only cover those backed by a PVC.
 type PodMetrics struct {
-	CPU    []MetricPoint
-	Memory []MetricPoint
+	CPU              []MetricPoint                `json:"cpu,omitempty"`
+	Memory           []MetricPoint                `json:"memory,omitempty"`
+	EphemeralStorage []MetricPoint                `json:"ephemeral_storage,omitempty"`
+	NetworkRx        []MetricPoint                `json:"network_rx,omitempty"`
+	NetworkTx        []MetricPoint                `json:"network_tx,omitempty"`
+	Containers       map[string]*ContainerMetrics `json:"containers,omitempty"`
+	Volumes          map[string]*VolumeMetrics    `json:"volumes,omitempty"`
+}
+
+// ContainerMetrics holds the series of a container. Filesystem is the bytes
+// its writable layer and logs use.
+type ContainerMetrics struct {
+	CPU        []MetricPoint `json:"cpu,omitempty"`
+	Memory     []MetricPoint `json:"memory,omitempty"`
+	Filesystem []MetricPoint `json:"filesystem,omitempty"`
 }
 
+// VolumeMetrics holds the series of the volume of a pod bound to PVC
+type VolumeMetrics struct {
+	PVC      string        `json:"pvc"`
+	Used     []MetricPoint `json:"used,omitempty"`
+	Capacity []MetricPoint `json:"capacity,omitempty"`
+}
+
+// MetricPoint is a sample taken at Timestamp, in Unix milliseconds
 type MetricPoint struct {
-	Timestamp int64
-	Value     float64
+	Timestamp int64   `json:"timestamp"`
+	Value     float64 `json:"value"`
+}
+
+// NodeSeries is the series of a node as shipped in a METRICS event
+type NodeSeries struct {
+	Node string `json:"node"`
+	NodeMetrics
+}
+
+// PodSeries is the series of a pod as shipped in a METRICS event
+type PodSeries struct {
+	Namespace string `json:"namespace"`
+	Pod       string `json:"pod"`
+	PodMetrics
+}
+
+func NewMetricsAggregator(retentionDays, maxPoints int) *MetricsAggregator {
+	return &MetricsAggregator{
+		nodeMetrics:   make(map[string]*NodeMetrics),
+		podMetrics:    make(map[string]*PodMetrics),
+		retentionDays: retentionDays,
+		maxPoints:     maxPoints,
+	}
+}
+
+// RecordNode adds the points of update to the series of node. It returns
+// the points that were new and false if there were none, as when the
+// source has not taken a new sample since the last poll.
+func (a *MetricsAggregator) RecordNode(node string, update NodeMetrics) (NodeMetrics, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	series, ok := a.nodeMetrics[node]
+	if !ok {
+		series = &NodeMetrics{}
+		a.nodeMetrics[node] = series
+	}
+	added := series.merge(update)
+	return added, !added.empty()
+}
+
+// RecordPod adds the points of update to the series of a pod, see RecordNode
+func (a *MetricsAggregator) RecordPod(namespace, pod string, update PodMetrics) (PodMetrics, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	key := namespace + "/" + pod
+	series, ok := a.podMetrics[key]
+	if !ok {
+		series = &PodMetrics{}
+		a.podMetrics[key] = series
+	}
+	added := series.merge(update)
+	return added, !added.empty()
+}
+
+// Prune drops the points older than the retention at now or beyond the
+// newest maxPoints, and the series left empty, such as those of deleted pods
+func (a *MetricsAggregator) Prune(now time.Time) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	r := retention{cutoff: now.AddDate(0, 0, -a.retentionDays).UnixMilli(), maxPoints: a.maxPoints}
+	for node, series := range a.nodeMetrics {
+		if series.prune(r); series.empty() {
+			delete(a.nodeMetrics, node)
+		}
+	}
+	for key, series := range a.podMetrics {
+		if series.prune(r); series.empty() {
+			delete(a.podMetrics, key)
+		}
+	}
+}
+
+func (m *NodeMetrics) merge(update NodeMetrics) NodeMetrics {
+	return NodeMetrics{
+		CPU:       merge(&m.CPU, update.CPU),
+		Memory:    merge(&m.Memory, update.Memory),
+		Disk:      merge(&m.Disk, update.Disk),
+		NetworkRx: merge(&m.NetworkRx, update.NetworkRx),
+		NetworkTx: merge(&m.NetworkTx, update.NetworkTx),
+	}
+}
+
+func (m *NodeMetrics) prune(r retention) {
+	m.CPU = prune(m.CPU, r)
+	m.Memory = prune(m.Memory, r)
+	m.Disk = prune(m.Disk, r)
+	m.NetworkRx = prune(m.NetworkRx, r)
+	m.NetworkTx = prune(m.NetworkTx, r)
+}
+
+func (m *NodeMetrics) empty() bool {
+	return len(m.CPU) == 0 && len(m.Memory) == 0 && len(m.Disk) == 0 &&
+		len(m.NetworkRx) == 0 && len(m.NetworkTx) == 0
+}
+
+func (m *PodMetrics) merge(update PodMetrics) PodMetrics {
+	added := PodMetrics{
+		CPU:              merge(&m.CPU, update.CPU),
+		Memory:           merge(&m.Memory, update.Memory),
+		EphemeralStorage: merge(&m.EphemeralStorage, update.EphemeralStorage),
+		NetworkRx:        merge(&m.NetworkRx, update.NetworkRx),
+		NetworkTx:        merge(&m.NetworkTx, update.NetworkTx),
+	}
+
+	for name, container := range update.Containers {
+		if m.Containers == nil {
+			m.Containers = make(map[string]*ContainerMetrics)
+		}
+		series, ok := m.Containers[name]
+		if !ok {
+			series = &ContainerMetrics{}
+			m.Containers[name] = series
+		}
+		if new := series.merge(*container); !new.empty() {
+			if added.Containers == nil {
+				added.Containers = make(map[string]*ContainerMetrics)
+			}
+			added.Containers[name] = &new
+		}
+	}
+
+	for name, volume := range update.Volumes {
+		if m.Volumes == nil {
+			m.Volumes = make(map[string]*VolumeMetrics)
+		}
+		series, ok := m.Volumes[name]
+		if !ok {
+			series = &VolumeMetrics{}
+			m.Volumes[name] = series
+		}
+		if new := series.merge(*volume); !new.empty() {
+			if added.Volumes == nil {
+				added.Volumes = make(map[string]*VolumeMetrics)
+			}
+			added.Volumes[name] = &new
+		}
+	}
+	return added
+}
+
+func (m *PodMetrics) prune(r retention) {
+	m.CPU = prune(m.CPU, r)
+	m.Memory = prune(m.Memory, r)
+	m.EphemeralStorage = prune(m.EphemeralStorage, r)
+	m.NetworkRx = prune(m.NetworkRx, r)
+	m.NetworkTx = prune(m.NetworkTx, r)
+	for name, container := range m.Containers {
+		if container.prune(r); container.empty() {
+			delete(m.Containers, name)
+		}
+	}
+	for name, volume := range m.Volumes {
+		if volume.prune(r); volume.empty() {
+			delete(m.Volumes, name)
+		}
+	}
+}
+
+func (m *PodMetrics) empty() bool {
+	return len(m.CPU) == 0 && len(m.Memory) == 0 && len(m.EphemeralStorage) == 0 &&
+		len(m.NetworkRx) == 0 && len(m.NetworkTx) == 0 && len(m.Containers) == 0 && len(m.Volumes) == 0
+}
+
+func (m *ContainerMetrics) merge(update ContainerMetrics) ContainerMetrics {
+	return ContainerMetrics{
+		CPU:        merge(&m.CPU, update.CPU),
+		Memory:     merge(&m.Memory, update.Memory),
+		Filesystem: merge(&m.Filesystem, update.Filesystem),
+	}
+}
+
+func (m *ContainerMetrics) prune(r retention) {
+	m.CPU = prune(m.CPU, r)
+	m.Memory = prune(m.Memory, r)
+	m.Filesystem = prune(m.Filesystem, r)
+}
+
+func (m *ContainerMetrics) empty() bool {
+	return len(m.CPU) == 0 && len(m.Memory) == 0 && len(m.Filesystem) == 0
+}
+
+// merge takes the PVC of update, as a volume may be rebound
+func (m *VolumeMetrics) merge(update VolumeMetrics) VolumeMetrics {
+	m.PVC = update.PVC
+	return VolumeMetrics{
+		PVC:      update.PVC,
+		Used:     merge(&m.Used, update.Used),
+		Capacity: merge(&m.Capacity, update.Capacity),
+	}
+}
+
+func (m *VolumeMetrics) prune(r retention) {
+	m.Used = prune(m.Used, r)
+	m.Capacity = prune(m.Capacity, r)
+}
+
+func (m *VolumeMetrics) empty() bool {
+	return len(m.Used) == 0 && len(m.Capacity) == 0
+}
+
+// merge appends the points later than the last one of series and returns
+// them
+func merge(series *[]MetricPoint, points []MetricPoint) []MetricPoint {
+	var added []MetricPoint
+	for _, point := range points {
+		if n := len(*series); n > 0 && (*series)[n-1].Timestamp >= point.Timestamp {
+			continue
+		}
+		*series = append(*series, point)
+		added = append(added, point)
+	}
+	return added
+}
+
+// retention is what Prune keeps of a series: the points from cutoff on,
+// at most maxPoints of them
+type retention struct {
+	cutoff    int64
+	maxPoints int
+}
+
+// prune drops the points of series outside r. Points are appended in time
+// order, so they are all at the start; the rest is copied to release the
+// backing array.
+func prune(series []MetricPoint, r retention) []MetricPoint {
+	i := max(len(series)-r.maxPoints, 0)
+	for i < len(series) && series[i].Timestamp < r.cutoff {
+		i++
+	}
+	if i == 0 {
+		return series
+	}
+	return append([]MetricPoint(nil), series[i:]...)
 }
@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	metricsv1beta1 "k8s.io/metrics/pkg/apis/metrics/v1beta1"
+)
+
+// collectNodes polls metrics.k8s.io for the usage of the node the collector
+// runs on, or every node without one, and records it. It returns the
+// samples that are new since the last poll.
+func (m *Metrics) collectNodes(ctx context.Context) ([]NodeSeries, error) {
+	var items []metricsv1beta1.NodeMetrics
+	if m.cfg.Metrics.NodeName != "" {
+		node, err := m.metrics.MetricsV1beta1().NodeMetricses().Get(ctx, m.cfg.Metrics.NodeName, metav1.GetOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get node metrics: %w", err)
+		}
+		items = append(items, *node)
+	} else {
+		list, err := m.metrics.MetricsV1beta1().NodeMetricses().List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list node metrics: %w", err)
+		}
+		items = list.Items
+	}
+
+	var series []NodeSeries
+	for _, node := range items {
+		ts := node.Timestamp.UnixMilli()
+		added, ok := m.aggregator.RecordNode(node.Name, NodeMetrics{
+			CPU:    point(ts, node.Usage.Cpu().AsApproximateFloat64()),
+			Memory: point(ts, float64(node.Usage.Memory().Value())),
+		})
+		if ok {
+			series = append(series, NodeSeries{Node: node.Name, NodeMetrics: added})
+		}
+	}
+	return series, nil
+}
+
+// collectPods polls metrics.k8s.io for the usage of the pods on the node the
+// collector runs on, or every pod without one, see collectNodes. Pod
+// metrics do not name the node, so on a node its pods are listed first and
+// the metrics of only their namespaces listed, rather than every DaemonSet
+// pod listing the metrics of the whole cluster on each poll. A namespace
+// whose metrics fail to list is skipped until the next poll.
+func (m *Metrics) collectPods(ctx context.Context) ([]PodSeries, error) {
+	var items []metricsv1beta1.PodMetrics
+	if m.cfg.Metrics.NodeName != "" {
+		pods, err := m.client.CoreV1().Pods(corev1.NamespaceAll).List(ctx, metav1.ListOptions{
+			FieldSelector: fields.OneTermEqualSelector("spec.nodeName", m.cfg.Metrics.NodeName).String(),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pods on node %s: %w", m.cfg.Metrics.NodeName, err)
+		}
+
+		onNode := make(map[string]map[string]bool)
+		for _, pod := range pods.Items {
+			if onNode[pod.Namespace] == nil {
+				onNode[pod.Namespace] = make(map[string]bool)
+			}
+			onNode[pod.Namespace][pod.Name] = true
+		}
+		for namespace, names := range onNode {
+			list, err := m.metrics.MetricsV1beta1().PodMetricses(namespace).List(ctx, metav1.ListOptions{})
+			if err != nil {
+				if ctx.Err() != nil {
+					return nil, ctx.Err()
+				}
+				m.log.Warn("failed to list pod metrics", "namespace", namespace, "error", err)
+				continue
+			}
+			// Pods not sampled yet, or already gone, have no metrics
+			for _, metrics := range list.Items {
+				if names[metrics.Name] {
+					items = append(items, metrics)
+				}
+			}
+		}
+	} else {
+		list, err := m.metrics.MetricsV1beta1().PodMetricses(corev1.NamespaceAll).List(ctx, metav1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pod metrics: %w", err)
+		}
+		items = list.Items
+	}
+
+	var series []PodSeries
+	for _, pod := range items {
+		var cpu, memory float64
+		for _, container := range pod.Containers {
+			cpu += container.Usage.Cpu().AsApproximateFloat64()
+			memory += float64(container.Usage.Memory().Value())
+		}
+		ts := pod.Timestamp.UnixMilli()
+		added, ok := m.aggregator.RecordPod(pod.Namespace, pod.Name, PodMetrics{
+			CPU:    point(ts, cpu),
+			Memory: point(ts, memory),
+		})
+		if ok {
+			series = append(series, PodSeries{Namespace: pod.Namespace, Pod: pod.Name, PodMetrics: added})
+		}
+	}
+	return series, nil
+}
+
+// point returns a series of the single point value at ts
+func point(ts int64, value float64) []MetricPoint {
+	return []MetricPoint{{Timestamp: ts, Value: value}}
+}
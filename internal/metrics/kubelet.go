@@ -0,0 +1,226 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	statsv1alpha1 "k8s.io/kubelet/pkg/apis/stats/v1alpha1"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// summaryClient reads the Summary API of the kubelet of one node, from the
+// kubelet itself, which needs get on nodes/stats, or through the API server
+// node proxy, which needs get on nodes/proxy. The proxy grants far more
+// than stats, so it is only used when asked for.
+type summaryClient struct {
+	node    string
+	proxy   rest.Interface
+	http    *http.Client
+	client  kubernetes.Interface
+	address string
+}
+
+func newSummaryClient(cfg *config.Config, restConfig *rest.Config, clientset kubernetes.Interface) (*summaryClient, error) {
+	kubelet := cfg.Metrics.Kubelet
+	if kubelet.Proxy {
+		return &summaryClient{node: cfg.Metrics.NodeName, proxy: clientset.CoreV1().RESTClient()}, nil
+	}
+
+	// The kubelet authenticates the agent like the API server does
+	kubeletConfig := rest.CopyConfig(restConfig)
+	if kubelet.InsecureSkipVerify {
+		kubeletConfig.Insecure = true
+		kubeletConfig.CAFile = ""
+		kubeletConfig.CAData = nil
+	}
+	httpClient, err := rest.HTTPClientFor(kubeletConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubelet client: %w", err)
+	}
+
+	return &summaryClient{
+		node:    cfg.Metrics.NodeName,
+		http:    httpClient,
+		client:  clientset,
+		address: strings.TrimSuffix(kubelet.Address, "/"),
+	}, nil
+}
+
+// kubeletAddress returns the address of the kubelet, looking it up in the
+// status of the node unless configured
+func (c *summaryClient) kubeletAddress(ctx context.Context) (string, error) {
+	if c.address != "" {
+		return c.address, nil
+	}
+
+	node, err := c.client.CoreV1().Nodes().Get(ctx, c.node, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("failed to get node %s: %w", c.node, err)
+	}
+	port := node.Status.DaemonEndpoints.KubeletEndpoint.Port
+	for _, addressType := range []corev1.NodeAddressType{corev1.NodeInternalIP, corev1.NodeExternalIP, corev1.NodeHostName} {
+		for _, address := range node.Status.Addresses {
+			if address.Type == addressType && address.Address != "" && port != 0 {
+				c.address = "https://" + net.JoinHostPort(address.Address, strconv.Itoa(int(port)))
+				return c.address, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("node %s does not report the address of its kubelet", c.node)
+}
+
+// get fetches the summary of the node
+func (c *summaryClient) get(ctx context.Context) (*statsv1alpha1.Summary, error) {
+	var body []byte
+	if c.proxy != nil {
+		raw, err := c.proxy.Get().Resource("nodes").Name(c.node).SubResource("proxy").Suffix("stats", "summary").DoRaw(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get summary of node %s: %w", c.node, err)
+		}
+		body = raw
+	} else {
+		address, err := c.kubeletAddress(ctx)
+		if err != nil {
+			return nil, err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, address+"/stats/summary", nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create summary request: %w", err)
+		}
+		resp, err := c.http.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get summary of node %s: %w", c.node, err)
+		}
+		defer resp.Body.Close()
+
+		body, err = io.ReadAll(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read summary of node %s: %w", c.node, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("failed to get summary of node %s: %s", c.node, resp.Status)
+		}
+	}
+
+	var summary statsv1alpha1.Summary
+	if err := json.Unmarshal(body, &summary); err != nil {
+		return nil, fmt.Errorf("failed to decode summary of node %s: %w", c.node, err)
+	}
+	return &summary, nil
+}
+
+// collectKubelet reads the summary of the node the collector runs on and
+// records the usage metrics.k8s.io does not report: disk and network of the
+// node, and ephemeral storage, network, containers and PVC-backed volumes
+// of its pods. It also records the CPU and memory of the pods, which spares
+// polling metrics.k8s.io for them. It returns the samples that are new since
+// the last poll.
+func (m *Metrics) collectKubelet(ctx context.Context) ([]NodeSeries, []PodSeries, error) {
+	summary, err := m.summary.get(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var nodes []NodeSeries
+	node := NodeMetrics{Disk: usedBytes(summary.Node.Fs)}
+	node.NetworkRx, node.NetworkTx = network(summary.Node.Network)
+	if added, ok := m.aggregator.RecordNode(summary.Node.NodeName, node); ok {
+		nodes = append(nodes, NodeSeries{Node: summary.Node.NodeName, NodeMetrics: added})
+	}
+
+	var pods []PodSeries
+	for _, stats := range summary.Pods {
+		pod := PodMetrics{EphemeralStorage: usedBytes(stats.EphemeralStorage)}
+		if stats.CPU != nil && stats.CPU.UsageNanoCores != nil {
+			pod.CPU = point(stats.CPU.Time.UnixMilli(), float64(*stats.CPU.UsageNanoCores)/1e9)
+		}
+		if stats.Memory != nil && stats.Memory.WorkingSetBytes != nil {
+			pod.Memory = point(stats.Memory.Time.UnixMilli(), float64(*stats.Memory.WorkingSetBytes))
+		}
+		pod.NetworkRx, pod.NetworkTx = network(stats.Network)
+
+		for _, container := range stats.Containers {
+			if pod.Containers == nil {
+				pod.Containers = make(map[string]*ContainerMetrics)
+			}
+			pod.Containers[container.Name] = containerMetrics(container)
+		}
+
+		for _, volume := range stats.VolumeStats {
+			if volume.PVCRef == nil {
+				continue
+			}
+			if pod.Volumes == nil {
+				pod.Volumes = make(map[string]*VolumeMetrics)
+			}
+			ts := volume.Time.UnixMilli()
+			metrics := &VolumeMetrics{PVC: volume.PVCRef.Name}
+			if volume.UsedBytes != nil {
+				metrics.Used = point(ts, float64(*volume.UsedBytes))
+			}
+			if volume.CapacityBytes != nil {
+				metrics.Capacity = point(ts, float64(*volume.CapacityBytes))
+			}
+			pod.Volumes[volume.Name] = metrics
+		}
+
+		if added, ok := m.aggregator.RecordPod(stats.PodRef.Namespace, stats.PodRef.Name, pod); ok {
+			pods = append(pods, PodSeries{Namespace: stats.PodRef.Namespace, Pod: stats.PodRef.Name, PodMetrics: added})
+		}
+	}
+	return nodes, pods, nil
+}
+
+// containerMetrics converts the stats of a container. CPU usage is reported
+// in nanocores.
+func containerMetrics(stats statsv1alpha1.ContainerStats) *ContainerMetrics {
+	metrics := &ContainerMetrics{}
+	if stats.CPU != nil && stats.CPU.UsageNanoCores != nil {
+		metrics.CPU = point(stats.CPU.Time.UnixMilli(), float64(*stats.CPU.UsageNanoCores)/1e9)
+	}
+	if stats.Memory != nil && stats.Memory.WorkingSetBytes != nil {
+		metrics.Memory = point(stats.Memory.Time.UnixMilli(), float64(*stats.Memory.WorkingSetBytes))
+	}
+	if stats.Rootfs != nil && stats.Rootfs.UsedBytes != nil {
+		used := *stats.Rootfs.UsedBytes
+		if stats.Logs != nil && stats.Logs.UsedBytes != nil {
+			used += *stats.Logs.UsedBytes
+		}
+		metrics.Filesystem = point(stats.Rootfs.Time.UnixMilli(), float64(used))
+	}
+	return metrics
+}
+
+// usedBytes returns the used bytes of fs as a series, empty if unknown
+func usedBytes(fs *statsv1alpha1.FsStats) []MetricPoint {
+	if fs == nil || fs.UsedBytes == nil {
+		return nil
+	}
+	return point(fs.Time.UnixMilli(), float64(*fs.UsedBytes))
+}
+
+// network returns the bytes received and sent on the default interface
+func network(stats *statsv1alpha1.NetworkStats) (rx, tx []MetricPoint) {
+	if stats == nil {
+		return nil, nil
+	}
+	ts := stats.Time.UnixMilli()
+	if stats.RxBytes != nil {
+		rx = point(ts, float64(*stats.RxBytes))
+	}
+	if stats.TxBytes != nil {
+		tx = point(ts, float64(*stats.TxBytes))
+	}
+	return rx, tx
+}
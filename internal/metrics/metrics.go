@@ -1,15 +1,183 @@
 package metrics
 
-import "github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
 
+	"k8s.io/client-go/kubernetes"
+	metricsclient "k8s.io/metrics/pkg/client/clientset/versioned"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/kube"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/sender"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// Metrics polls the resource usage of nodes and pods every
+// Kubernetes.PollInterval, keeps it in a MetricsAggregator and ships the new
+// samples of every poll as METRICS events. On a node, as in the DaemonSet,
+// the kubelet adds what metrics.k8s.io lacks.
 type Metrics struct {
-	cfg *config.Config
+	cfg        *config.Config
+	client     kubernetes.Interface
+	metrics    metricsclient.Interface
+	summary    *summaryClient
+	sender     *sender.Sender
+	aggregator *MetricsAggregator
+	log        *slog.Logger
 }
 
 func New(cfg *config.Config) (*Metrics, error) {
-	return &Metrics{cfg: cfg}, nil
+	restConfig, err := kube.RESTConfig(cfg.Kubernetes.Connection)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
+	}
+
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	metricsClient, err := metricsclient.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create metrics client: %w", err)
+	}
+
+	var summary *summaryClient
+	if cfg.Metrics.Kubelet.Enabled && cfg.Metrics.NodeName != "" {
+		summary, err = newSummaryClient(cfg, restConfig, clientset)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	sender, err := sender.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sender: %w", err)
+	}
+
+	return &Metrics{
+		cfg:        cfg,
+		client:     clientset,
+		metrics:    metricsClient,
+		summary:    summary,
+		sender:     sender,
+		aggregator: NewMetricsAggregator(cfg.Metrics.RetentionDays, cfg.Metrics.MaxPoints),
+		log:        logging.For(logging.ComponentMetrics),
+	}, nil
+}
+
+// Run collects metrics until ctx is cancelled, then gives the sender up to
+// the drain timeout to deliver what is spooled
+func (m *Metrics) Run(ctx context.Context) error {
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		m.sender.Run(ctx)
+	}()
+	defer m.shutdown(senderDone)
+
+	ticker := time.NewTicker(m.cfg.Kubernetes.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		m.poll(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
 }
 
-func (m *Metrics) Run() error {
-	return nil
+// poll collects and ships one round of samples. A failure is logged and
+// the next poll tries again; every source is collected independently.
+func (m *Metrics) poll(ctx context.Context) {
+	nodes, err := m.collectNodes(ctx)
+	if err != nil && ctx.Err() == nil {
+		m.log.Warn("failed to collect node metrics", "error", err)
+	}
+
+	// The kubelet reports the CPU and memory of the pods on its node too
+	var pods []PodSeries
+	if m.summary == nil {
+		pods, err = m.collectPods(ctx)
+		if err != nil && ctx.Err() == nil {
+			m.log.Warn("failed to collect pod metrics", "error", err)
+		}
+	} else {
+		var kubeletNodes []NodeSeries
+		kubeletNodes, pods, err = m.collectKubelet(ctx)
+		if err != nil && ctx.Err() == nil {
+			m.log.Warn("failed to collect kubelet metrics", "error", err)
+		}
+		nodes = mergeNodeSeries(nodes, kubeletNodes)
+	}
+	m.ship(types.TypeNode, len(nodes), nodes)
+	m.ship(types.TypePod, len(pods), pods)
+
+	m.aggregator.Prune(time.Now())
+}
+
+// mergeNodeSeries combines the series of the same node from two sources
+// into one, so a poll ships a single series per node
+func mergeNodeSeries(nodes, more []NodeSeries) []NodeSeries {
+	for _, series := range more {
+		i := slices.IndexFunc(nodes, func(n NodeSeries) bool { return n.Node == series.Node })
+		if i < 0 {
+			nodes = append(nodes, series)
+			continue
+		}
+		node := &nodes[i].NodeMetrics
+		node.CPU = append(node.CPU, series.CPU...)
+		node.Memory = append(node.Memory, series.Memory...)
+		node.Disk = append(node.Disk, series.Disk...)
+		node.NetworkRx = append(node.NetworkRx, series.NetworkRx...)
+		node.NetworkTx = append(node.NetworkTx, series.NetworkTx...)
+	}
+	return nodes
+}
+
+// ship spools the count new series of resourceType in a METRICS event
+func (m *Metrics) ship(resourceType types.ResourceType, count int, series interface{}) {
+	if count == 0 {
+		return
+	}
+
+	if err := m.sender.Enqueue(types.ResourceEvent{
+		ClusterName:  m.cfg.Kubernetes.ClusterName,
+		ResourceType: resourceType,
+		EventType:    types.EventTypeMetrics,
+		Timestamp:    time.Now(),
+		Payload:      series,
+	}); err != nil {
+		m.log.Error("failed to spool metrics", "resource_type", resourceType, "error", err)
+		return
+	}
+	m.log.Debug("spooled metrics", "resource_type", resourceType, "series", count)
+}
+
+func (m *Metrics) shutdown(senderDone <-chan struct{}) {
+	<-senderDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), m.cfg.Sender.DrainTimeout)
+	defer cancel()
+
+	flushed, err := m.sender.Drain(ctx)
+	if err != nil {
+		m.log.Warn("drain interrupted", "error", err)
+	}
+	spooled, err := m.sender.Pending()
+	if err != nil {
+		m.log.Error("failed to count spooled events", "error", err)
+	}
+	if err := m.sender.Close(); err != nil {
+		m.log.Error("failed to close sender", "error", err)
+	}
+	m.log.Info("shut down", "flushed", flushed, "spooled", spooled)
 }
@@ -1,6 +1,10 @@
 package server
 
-import "github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+import (
+	"context"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
 
 type Server struct {
 	cfg *config.Config
@@ -10,6 +14,8 @@ func New(cfg *config.Config) (*Server, error) {
 	return &Server{cfg: cfg}, nil
 }
 
-func (s *Server) Run() error {
-	return nil
+// Run serves until ctx is cancelled
+func (s *Server) Run(ctx context.Context) error {
+	<-ctx.Done()
+	return ctx.Err()
 }
@@ -0,0 +1,117 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/kube"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+var (
+	leaseResource  = schema.GroupVersionResource{Group: "coordination.k8s.io", Version: "v1", Resource: "leases"}
+	secretResource = schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+)
+
+// Requirement is an API the watcher uses with the access it needs to it.
+// Home requirements only apply to the cluster the agent connects to, the
+// others to every watched cluster.
+type Requirement struct {
+	kube.Access
+	Purpose string
+	Home    bool
+}
+
+// Requirements lists the access the watcher needs with cfg: list and watch
+// on every included resource type in scope, in every namespace of a namespaced scope,
+// and the CRDs, lease and cluster secrets it is configured to use. CRDs are
+// cluster-scoped, so a namespaced scope does not discover them.
+func Requirements(cfg *config.Config) []Requirement {
+	scope := newScope(cfg)
+	listWatch := []string{"list", "watch"}
+
+	var requirements []Requirement
+	for _, r := range resources {
+		if !scope.includes(r.resourceType) || !scope.watches(r.namespaced) {
+			continue
+		}
+		namespaces := []string{""}
+		if r.namespaced {
+			namespaces = scope.namespaces()
+		}
+		for _, namespace := range namespaces {
+			requirements = append(requirements, Requirement{
+				Access:  kube.Access{Resource: r.gvr, Namespace: namespace, Verbs: listWatch},
+				Purpose: "watch " + string(r.resourceType),
+			})
+		}
+	}
+
+	// A namespaced scope only watches namespaced dynamic resources, in each
+	// of its namespaces, see dynamicWatcher.reconcile
+	for _, resource := range cfg.Kubernetes.Dynamic.Resources {
+		gvr, err := parseGVR(resource)
+		if err != nil {
+			continue
+		}
+		for _, namespace := range scope.namespaces() {
+			requirements = append(requirements, Requirement{
+				Access:  kube.Access{Resource: gvr, Namespace: namespace, Verbs: listWatch},
+				Purpose: "watch " + string(types.ResourceTypeForGVR(gvr)),
+			})
+		}
+	}
+	if len(cfg.Kubernetes.Dynamic.CRDGroups) > 0 && !cfg.Kubernetes.Scope.Namespaced() {
+		requirements = append(requirements, Requirement{
+			Access:  kube.Access{Resource: crdResource, Verbs: listWatch},
+			Purpose: "discover custom resources",
+		})
+	}
+
+	if cfg.LeaderElection.Enabled {
+		requirements = append(requirements, Requirement{
+			Access:  kube.Access{Resource: leaseResource, Namespace: cfg.LeaderElection.LeaseNamespace, Verbs: []string{"get", "create", "update"}},
+			Purpose: "leader election",
+			Home:    true,
+		})
+	}
+	if cfg.Kubernetes.ClusterSecrets.Namespace != "" {
+		requirements = append(requirements, Requirement{
+			Access:  kube.Access{Resource: secretResource, Namespace: cfg.Kubernetes.ClusterSecrets.Namespace, Verbs: listWatch},
+			Purpose: "cluster secrets",
+			Home:    true,
+		})
+	}
+	return requirements
+}
+
+// unavailable reports why the informer of r in namespace cannot run, or
+// returns an empty string if it can. An API the cluster does not serve or
+// access the agent lacks degrades the resource type without starting its
+// informer until a later check passes. When the check itself fails the
+// informer is started anyway.
+func unavailable(ctx context.Context, client kubernetes.Interface, discovery discovery.DiscoveryInterface, r resource, namespace string) (string, error) {
+	served, err := kube.Served(discovery, r.gvr)
+	if err != nil {
+		return "", err
+	}
+	if !served {
+		return fmt.Sprintf("%s is not served", r.gvr.GroupVersion()), nil
+	}
+
+	access := kube.Access{Resource: r.gvr, Namespace: namespace, Verbs: []string{"list", "watch"}}
+	denied, err := kube.Denied(ctx, client, access)
+	if err != nil {
+		return "", err
+	}
+	if len(denied) > 0 {
+		return fmt.Sprintf("forbidden to %s %s%s", strings.Join(denied, " and "), r.gvr.GroupResource(), inNamespace(namespace)), nil
+	}
+	return "", nil
+}
@@ -0,0 +1,301 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// clusterWatcher watches a single cluster. Every cluster has its own
+// clients and informer factory, so a cluster that is slow or unreachable
+// only holds up its own informers.
+type clusterWatcher struct {
+	name       string
+	restConfig *rest.Config
+	client     kubernetes.Interface
+	factory    *resourceWatcherFactory
+	dynamic    *dynamicWatcher
+
+	// informerFactories holds a factory per watched namespace, see scope
+	informerFactories map[string]informers.SharedInformerFactory
+
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	mu      sync.RWMutex
+	watches []*resourceWatch
+	synced  bool
+}
+
+// resourceWatch is the shared informer of one resource type in a namespace
+// together with the handler registered on it
+type resourceWatch struct {
+	resourceType types.ResourceType
+	namespace    string
+	informer     cache.SharedIndexInformer
+	registration cache.ResourceEventHandlerRegistration
+	snapshot     *snapshot
+}
+
+func newClusterWatcher(w *Watcher, name string, restConfig *rest.Config) (*clusterWatcher, error) {
+	clientset, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create clientset: %w", err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create dynamic client: %w", err)
+	}
+
+	scope := newScope(w.current.Load())
+	informerFactories := make(map[string]informers.SharedInformerFactory)
+	for _, namespace := range scope.namespaces() {
+		informerFactories[namespace] = informers.NewSharedInformerFactoryWithOptions(clientset, time.Hour*24, informers.WithNamespace(namespace))
+	}
+	factory := newResourceWatcherFactory(w.sender, &w.pipeline, name, scope, w.cfg.Kubernetes.SnapshotChunkSize, w.cfg.LeaderElection.Enabled)
+
+	return &clusterWatcher{
+		name:              name,
+		restConfig:        restConfig,
+		client:            clientset,
+		factory:           factory,
+		dynamic:           newDynamicWatcher(w.current.Load(), dynamicClient, clientset.Discovery(), factory),
+		informerFactories: informerFactories,
+		done:              make(chan struct{}),
+	}, nil
+}
+
+// run watches the cluster until ctx is cancelled
+func (c *clusterWatcher) run(ctx context.Context) error {
+	for _, informerFactory := range c.informerFactories {
+		defer informerFactory.Shutdown()
+	}
+
+	// Handlers go in before the factories start so they see every object
+	if err := c.setupWatchers(ctx); err != nil {
+		return err
+	}
+
+	for _, informerFactory := range c.informerFactories {
+		informerFactory.Start(ctx.Done())
+	}
+
+	if err := c.waitForSnapshots(ctx); err != nil {
+		return fmt.Errorf("initial snapshot failed: %w", err)
+	}
+
+	c.mu.Lock()
+	c.synced = true
+	c.mu.Unlock()
+
+	// Runs even without dynamic resources, a reload may configure some.
+	// The cluster is done only once its dynamic informers have stopped.
+	var dynamicDone sync.WaitGroup
+	defer dynamicDone.Wait()
+	dynamicDone.Add(1)
+	go func() {
+		defer dynamicDone.Done()
+		if err := c.dynamic.Run(ctx); err != nil && ctx.Err() == nil {
+			c.factory.log.Error("dynamic watcher failed", "error", err)
+		}
+	}()
+
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+// setupWatchers registers the event handlers of every resource type in the
+// registry that is included and in scope on its shared informer, in every watched namespace.
+// Resource types the cluster does not serve or the agent may not list and
+// watch are degraded instead, and retried until they become available, see
+// unavailable.
+func (c *clusterWatcher) setupWatchers(ctx context.Context) error {
+	for namespace := range c.informerFactories {
+		for _, r := range resources {
+			if !c.factory.scope.includes(r.resourceType) || !c.factory.scope.watches(r.namespaced) {
+				continue
+			}
+
+			reason, err := unavailable(ctx, c.client, c.client.Discovery(), r, namespace)
+			if err != nil {
+				c.factory.log.Warn("failed to check access, watching anyway", "resource_type", r.resourceType, "namespace", namespace, "error", err)
+			}
+			if reason != "" {
+				c.factory.setDegraded(resourceKey{resourceType: r.resourceType, namespace: namespace}, reason, "")
+				go c.retry(ctx, namespace, r)
+				continue
+			}
+
+			if err := c.startWatch(ctx, namespace, r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// retryBackoff paces the checks of a resource type that is unavailable
+var retryBackoff = wait.Backoff{
+	Duration: time.Second * 10,
+	Factor:   2,
+	Jitter:   0.1,
+	Steps:    math.MaxInt32,
+	Cap:      time.Minute * 5,
+}
+
+// retry checks with backoff whether r has become available in namespace,
+// typically after the API was installed or access was granted, and starts
+// watching it once it has
+func (c *clusterWatcher) retry(ctx context.Context, namespace string, r resource) {
+	backoff := retryBackoff
+	for {
+		select {
+		case <-time.After(backoff.Step()):
+		case <-ctx.Done():
+			return
+		}
+
+		reason, err := unavailable(ctx, c.client, c.client.Discovery(), r, namespace)
+		if err != nil {
+			c.factory.log.Warn("failed to check access, watching anyway", "resource_type", r.resourceType, "namespace", namespace, "error", err)
+		}
+		if reason != "" {
+			c.factory.setDegraded(resourceKey{resourceType: r.resourceType, namespace: namespace}, reason, "")
+			continue
+		}
+
+		if err := c.startWatch(ctx, namespace, r); err != nil {
+			c.factory.log.Error("failed to start watch", "resource_type", r.resourceType, "namespace", namespace, "error", err)
+			return
+		}
+		// A no-op for the informers that run already
+		c.informerFactories[namespace].Start(ctx.Done())
+		return
+	}
+}
+
+// startWatch registers the handler of r on its informer in namespace. The
+// informer runs once its factory is started; its snapshot completes once
+// it has synced, however long its initial list keeps failing.
+func (c *clusterWatcher) startWatch(ctx context.Context, namespace string, r resource) error {
+	informer := r.informer(c.informerFactories[namespace], namespace, c.factory.scope.tweak(r.resourceType))
+	handler, snap := c.factory.createEventHandlers(r.resourceType, namespace, informer)
+
+	if err := informer.SetWatchErrorHandler(c.factory.watchErrorHandler(r.resourceType, namespace)); err != nil {
+		return fmt.Errorf("failed to set %s watch error handler%s: %w", r.resourceType, inNamespace(namespace), err)
+	}
+
+	registration, err := c.factory.addEventHandler(snap, handler)
+	if err != nil {
+		return fmt.Errorf("failed to add %s event handler%s: %w", r.resourceType, inNamespace(namespace), err)
+	}
+
+	c.mu.Lock()
+	c.watches = append(c.watches, &resourceWatch{
+		resourceType: r.resourceType,
+		namespace:    namespace,
+		informer:     informer,
+		registration: registration,
+		snapshot:     snap,
+	})
+	c.mu.Unlock()
+
+	key := resourceKey{resourceType: r.resourceType, namespace: namespace}
+	go c.factory.monitor(ctx, key, informer, registration, snap)
+	return nil
+}
+
+// inNamespace qualifies a message about an informer limited to namespace
+func inNamespace(namespace string) string {
+	if namespace == "" {
+		return ""
+	}
+	return " in namespace " + namespace
+}
+
+// waitForSnapshots waits until every handler has been handed the initial
+// list of its informer and completes the snapshots built from it. The
+// initial inventory is served from the informer caches instead of a second
+// round of LIST calls, and it is tied to the same stream the deltas come from.
+// Degraded informers are not waited for; their snapshots follow once they
+// recover.
+func (c *clusterWatcher) waitForSnapshots(ctx context.Context) error {
+	c.mu.RLock()
+	watches := c.watches
+	c.mu.RUnlock()
+
+	for _, watch := range watches {
+		key := resourceKey{resourceType: watch.resourceType, namespace: watch.namespace}
+		settled := func() bool {
+			return watch.registration.HasSynced() || c.factory.isDegraded(key)
+		}
+		if !cache.WaitForCacheSync(ctx.Done(), settled) {
+			return fmt.Errorf("failed to replay %s cache%s", watch.resourceType, inNamespace(watch.namespace))
+		}
+		if watch.registration.HasSynced() {
+			c.factory.completeSnapshot(watch.snapshot)
+		}
+	}
+	return nil
+}
+
+// ClusterHealth is the state of one watched cluster. Synced is set once the
+// initial snapshot of every built-in resource type has been spooled or the
+// type found degraded; Resources tells for each resource type whether its
+// informers have synced. Degraded holds the resource types that currently
+// fail to list or watch and why. Ready sums them up, see ready.
+type ClusterHealth struct {
+	Ready     bool                          `json:"ready"`
+	Synced    bool                          `json:"synced"`
+	Resources map[types.ResourceType]bool   `json:"resources"`
+	Degraded  map[types.ResourceType]string `json:"degraded,omitempty"`
+}
+
+// ready reports whether the cluster has synced and shipped its snapshots.
+// Degraded resource types do not hold the others up.
+func (h ClusterHealth) ready() bool {
+	if !h.Synced {
+		return false
+	}
+	for resourceType, synced := range h.Resources {
+		if _, degraded := h.Degraded[resourceType]; !synced && !degraded {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *clusterWatcher) health() ClusterHealth {
+	c.mu.RLock()
+	health := ClusterHealth{
+		Synced:    c.synced,
+		Resources: make(map[types.ResourceType]bool),
+	}
+	for _, watch := range c.watches {
+		synced, seen := health.Resources[watch.resourceType]
+		health.Resources[watch.resourceType] = (synced || !seen) && watch.registration.HasSynced()
+	}
+	c.mu.RUnlock()
+
+	if degraded := c.factory.degradedTypes(); len(degraded) > 0 {
+		health.Degraded = degraded
+	}
+
+	for resourceType, synced := range c.dynamic.syncStatus() {
+		health.Resources[resourceType] = synced
+	}
+	health.Ready = health.ready()
+	return health
+}
@@ -0,0 +1,189 @@
+package watcher
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// recoveryInterval is how often a degraded informer is checked for progress
+const recoveryInterval = time.Second * 10
+
+// resourceKey identifies the informer of a resource type in a namespace,
+// empty for all namespaces
+type resourceKey struct {
+	resourceType types.ResourceType
+	namespace    string
+}
+
+// degradation is why an informer fails. resourceVersion is the last one it
+// had synced when it failed; once it moves on the informer has recovered.
+type degradation struct {
+	reason          string
+	resourceVersion string
+}
+
+// watchErrorHandler counts watches that failed and are restarted, leaving
+// the logging to client-go. Failures other than an expired or closed watch
+// mark the informer degraded until it makes progress again; the reflector
+// keeps retrying it with backoff meanwhile.
+func (f *resourceWatcherFactory) watchErrorHandler(resourceType types.ResourceType, namespace string) cache.WatchErrorHandler {
+	key := resourceKey{resourceType: resourceType, namespace: namespace}
+	return func(r *cache.Reflector, err error) {
+		telemetry.WatchRestarts.WithLabelValues(f.clusterName, string(resourceType)).Inc()
+		if !expectedWatchError(err) {
+			f.setDegraded(key, err.Error(), r.LastSyncResourceVersion())
+		}
+		cache.DefaultWatchErrorHandler(r, err)
+	}
+}
+
+// expectedWatchError reports whether err is part of normal watch operation
+func expectedWatchError(err error) bool {
+	return apierrors.IsResourceExpired(err) || apierrors.IsGone(err) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// monitor completes the snapshot of an informer once it has synced, which
+// is delayed for as long as its initial list fails, and then marks it
+// healthy whenever it recovers from a failure
+func (f *resourceWatcherFactory) monitor(ctx context.Context, key resourceKey, informer cache.SharedIndexInformer, registration cache.ResourceEventHandlerRegistration, snap *snapshot) {
+	if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+		return
+	}
+	f.completeSnapshot(snap)
+	f.setHealthy(key)
+
+	ticker := time.NewTicker(recoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			f.recovered(key, informer.LastSyncResourceVersion())
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// setDegraded marks the informer of key as failing. The first failure is
+// logged and reported to the backend, later ones only update the reason.
+func (f *resourceWatcherFactory) setDegraded(key resourceKey, reason, resourceVersion string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	_, degraded := f.degraded[key]
+	f.degraded[key] = degradation{reason: reason, resourceVersion: resourceVersion}
+	if degraded {
+		return
+	}
+
+	f.log.Warn("resource type degraded", "resource_type", key.resourceType, "namespace", key.namespace, "reason", reason)
+	f.updateDegradedMetric(key.resourceType)
+	f.sendStatus(key, types.ResourceStateDegraded, reason)
+}
+
+// setHealthy clears the degraded state of the informer of key, if any
+func (f *resourceWatcherFactory) setHealthy(key resourceKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, degraded := f.degraded[key]; !degraded {
+		return
+	}
+	delete(f.degraded, key)
+
+	f.log.Info("resource type recovered", "resource_type", key.resourceType, "namespace", key.namespace)
+	f.updateDegradedMetric(key.resourceType)
+	f.sendStatus(key, types.ResourceStateHealthy, "")
+}
+
+// recovered marks a degraded informer healthy once it has synced a newer
+// resourceVersion than the one it failed at
+func (f *resourceWatcherFactory) recovered(key resourceKey, resourceVersion string) {
+	f.mu.Lock()
+	d, degraded := f.degraded[key]
+	f.mu.Unlock()
+
+	if degraded && resourceVersion != "" && resourceVersion != d.resourceVersion {
+		f.setHealthy(key)
+	}
+}
+
+// forget drops the state of an informer that was stopped
+func (f *resourceWatcherFactory) forget(key resourceKey) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, degraded := f.degraded[key]; degraded {
+		delete(f.degraded, key)
+		f.updateDegradedMetric(key.resourceType)
+	}
+}
+
+// isDegraded reports whether the informer of key is failing
+func (f *resourceWatcherFactory) isDegraded(key resourceKey) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, degraded := f.degraded[key]
+	return degraded
+}
+
+// degradedTypes returns the reason of every degraded resource type. With
+// several namespaces failing, one of their reasons is returned.
+func (f *resourceWatcherFactory) degradedTypes() map[types.ResourceType]string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	reasons := make(map[types.ResourceType]string, len(f.degraded))
+	for key, d := range f.degraded {
+		reason := d.reason
+		if key.namespace != "" {
+			reason = key.namespace + ": " + reason
+		}
+		reasons[key.resourceType] = reason
+	}
+	return reasons
+}
+
+// updateDegradedMetric sets the degraded informer count of resourceType.
+// f.mu must be held.
+func (f *resourceWatcherFactory) updateDegradedMetric(resourceType types.ResourceType) {
+	count := 0
+	for key := range f.degraded {
+		if key.resourceType == resourceType {
+			count++
+		}
+	}
+	telemetry.ResourcesDegraded.WithLabelValues(f.clusterName, string(resourceType)).Set(float64(count))
+}
+
+// sendStatus spools a STATUS event, unless on standby; a new leader reports
+// what is degraded when it takes over, see lead. f.mu must be held.
+func (f *resourceWatcherFactory) sendStatus(key resourceKey, state types.ResourceState, reason string) {
+	if !f.leading {
+		return
+	}
+
+	if err := f.sender.Enqueue(types.ResourceEvent{
+		ClusterName:  f.clusterName,
+		ResourceType: key.resourceType,
+		EventType:    types.EventTypeStatus,
+		Timestamp:    time.Now(),
+		Status: &types.StatusInfo{
+			State:     state,
+			Namespace: key.namespace,
+			Reason:    reason,
+		},
+	}); err != nil {
+		f.log.Error("failed to spool status", "resource_type", key.resourceType, "error", err)
+	}
+}
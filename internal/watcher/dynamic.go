@@ -0,0 +1,384 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+var crdResource = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// dynamicWatcher watches resources that have no typed informer, such as
+// CRDs, through the dynamic client. The set of watched GroupVersionResources
+// is reconciled against discovery and the installed CRDs, so resources
+// appearing or disappearing at runtime are picked up without a restart.
+type dynamicWatcher struct {
+	cfg       *config.Config
+	client    dynamic.Interface
+	discovery discovery.DiscoveryInterface
+	factory   *resourceWatcherFactory
+
+	trigger chan struct{}
+
+	// spec is the set of resources to watch, which a reload can change
+	mu          sync.Mutex
+	spec        config.Dynamic
+	crdInformer cache.SharedIndexInformer
+	watches     map[schema.GroupVersionResource]context.CancelFunc
+
+	// running tracks the CRD informer and the watches, which Run waits for
+	running sync.WaitGroup
+
+	// syncMu is separate from mu so health checks do not wait on discovery
+	syncMu sync.Mutex
+	synced map[types.ResourceType]bool
+}
+
+func newDynamicWatcher(cfg *config.Config, client dynamic.Interface, discovery discovery.DiscoveryInterface, factory *resourceWatcherFactory) *dynamicWatcher {
+	return &dynamicWatcher{
+		cfg:       cfg,
+		client:    client,
+		discovery: discovery,
+		factory:   factory,
+		spec:      cfg.Kubernetes.Dynamic,
+		trigger:   make(chan struct{}, 1),
+		watches:   make(map[schema.GroupVersionResource]context.CancelFunc),
+		synced:    make(map[types.ResourceType]bool),
+	}
+}
+
+// configure replaces the set of resources to watch and reconciles the
+// running informers against it
+func (d *dynamicWatcher) configure(spec config.Dynamic) {
+	d.mu.Lock()
+	d.spec = spec
+	d.mu.Unlock()
+	d.poke()
+}
+
+// Run reconciles the watched resources whenever a CRD changes, the
+// configured resources change and every discovery interval until ctx is
+// cancelled, then waits for every informer it started to stop
+func (d *dynamicWatcher) Run(ctx context.Context) error {
+	defer d.running.Wait()
+
+	ticker := time.NewTicker(d.cfg.Kubernetes.Dynamic.DiscoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := d.reconcile(ctx); err != nil {
+			return err
+		}
+
+		select {
+		case <-d.trigger:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// watchCRDs starts the CRD informer the first time CRD groups are
+// configured. Its notifications trigger a reconcile, including the ones
+// for the initial list. CRDs are cluster-scoped, so a namespaced scope
+// leaves them alone, see scope.watches. d.mu must be held.
+func (d *dynamicWatcher) watchCRDs(ctx context.Context) error {
+	if d.crdInformer != nil || len(d.spec.CRDGroups) == 0 || !d.factory.scope.watches(false) {
+		return nil
+	}
+
+	informer := dynamicinformer.NewFilteredDynamicInformer(d.client, crdResource, "", time.Hour*24, cache.Indexers{}, nil).Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc:    func(interface{}) { d.poke() },
+		UpdateFunc: func(interface{}, interface{}) { d.poke() },
+		DeleteFunc: func(interface{}) { d.poke() },
+	}); err != nil {
+		return fmt.Errorf("failed to add CRD event handler: %w", err)
+	}
+
+	d.crdInformer = informer
+	d.running.Add(1)
+	go func() {
+		defer d.running.Done()
+		informer.Run(ctx.Done())
+	}()
+	return nil
+}
+
+func (d *dynamicWatcher) poke() {
+	select {
+	case d.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// reconcile starts informers for newly available or configured resources
+// and stops the ones whose API went away or that are no longer configured
+func (d *dynamicWatcher) reconcile(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if err := d.watchCRDs(ctx); err != nil {
+		return err
+	}
+
+	// desired maps each resource to whether it is namespaced
+	desired := make(map[schema.GroupVersionResource]bool)
+
+	for _, resource := range d.spec.Resources {
+		gvr, err := parseGVR(resource)
+		if err != nil {
+			d.factory.log.Warn("ignoring dynamic resource", "error", err)
+			continue
+		}
+		desired[gvr] = false
+	}
+
+	if d.crdInformer != nil && len(d.spec.CRDGroups) > 0 {
+		for _, obj := range d.crdInformer.GetStore().List() {
+			if gvr, ok := d.crdGVR(obj.(*unstructured.Unstructured)); ok {
+				desired[gvr] = false
+			}
+		}
+	}
+
+	for gvr := range desired {
+		served, namespaced, err := d.served(gvr)
+		if err != nil {
+			// Keep what is already running through a discovery hiccup
+			d.factory.log.Warn("failed to discover resource", "group_version", gvr.GroupVersion().String(), "error", err)
+			_, served = d.watches[gvr]
+			namespaced = true
+		}
+		if !served || !d.factory.scope.watches(namespaced) {
+			delete(desired, gvr)
+			continue
+		}
+		desired[gvr] = namespaced
+	}
+
+	for gvr, cancel := range d.watches {
+		if _, ok := desired[gvr]; !ok {
+			d.factory.log.Info("stopping watch, resource is no longer served or configured", "resource_type", types.ResourceTypeForGVR(gvr))
+			cancel()
+			delete(d.watches, gvr)
+		}
+	}
+
+	for gvr, namespaced := range desired {
+		if _, ok := d.watches[gvr]; ok {
+			continue
+		}
+		watchCtx, cancel := context.WithCancel(ctx)
+		d.watches[gvr] = cancel
+		d.running.Add(1)
+		go func() {
+			defer d.running.Done()
+			d.watch(watchCtx, gvr, namespaced)
+		}()
+	}
+	return nil
+}
+
+// watch runs the informers for gvr, one per watched namespace if it is
+// namespaced, until ctx is cancelled, shipping their snapshots once their
+// caches have synced. It returns once they have stopped.
+func (d *dynamicWatcher) watch(ctx context.Context, gvr schema.GroupVersionResource, namespaced bool) {
+	resourceType := types.ResourceTypeForGVR(gvr)
+
+	d.setSynced(resourceType, false)
+	defer d.clearSynced(resourceType)
+
+	var running sync.WaitGroup
+
+	namespaces := []string{metav1.NamespaceAll}
+	if namespaced {
+		namespaces = d.factory.scope.namespaces()
+	}
+
+	var informers []cache.SharedIndexInformer
+	var registrations []cache.ResourceEventHandlerRegistration
+	var snapshots []*snapshot
+	for _, namespace := range namespaces {
+		informer := dynamicinformer.NewFilteredDynamicInformer(d.client, gvr, namespace, time.Hour*24, cache.Indexers{}, dynamicinformer.TweakListOptionsFunc(d.factory.scope.tweak(resourceType))).Informer()
+
+		handler, snap := d.factory.createEventHandlers(resourceType, namespace, informer)
+		defer d.factory.release(snap)
+		defer d.factory.forget(resourceKey{resourceType: resourceType, namespace: namespace})
+
+		if err := informer.SetWatchErrorHandler(d.factory.watchErrorHandler(resourceType, namespace)); err != nil {
+			d.factory.log.Error("failed to set watch error handler", "resource_type", resourceType, "error", err)
+			return
+		}
+
+		registration, err := d.factory.addEventHandler(snap, handler)
+		if err != nil {
+			d.factory.log.Error("failed to add event handler", "resource_type", resourceType, "error", err)
+			return
+		}
+
+		informers = append(informers, informer)
+		registrations = append(registrations, registration)
+		snapshots = append(snapshots, snap)
+	}
+
+	// Deferred last, so the informers have stopped before their snapshots
+	// and degraded state are released
+	defer running.Wait()
+	for i, informer := range informers {
+		running.Add(2)
+		go func() {
+			defer running.Done()
+			informer.Run(ctx.Done())
+		}()
+		go func() {
+			defer running.Done()
+			d.factory.monitor(ctx, resourceKey{resourceType: resourceType, namespace: namespaces[i]}, informer, registrations[i], snapshots[i])
+		}()
+	}
+
+	// A namespace that is degraded holds up the synced state of the
+	// resource type, the others ship their snapshots meanwhile
+	for _, registration := range registrations {
+		if !cache.WaitForCacheSync(ctx.Done(), registration.HasSynced) {
+			return
+		}
+	}
+	d.setSynced(resourceType, true)
+	<-ctx.Done()
+}
+
+func (d *dynamicWatcher) setSynced(resourceType types.ResourceType, synced bool) {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	d.synced[resourceType] = synced
+}
+
+func (d *dynamicWatcher) clearSynced(resourceType types.ResourceType) {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+	delete(d.synced, resourceType)
+}
+
+// syncStatus reports, for every watched resource, whether its snapshot is complete
+func (d *dynamicWatcher) syncStatus() map[types.ResourceType]bool {
+	d.syncMu.Lock()
+	defer d.syncMu.Unlock()
+
+	status := make(map[types.ResourceType]bool, len(d.synced))
+	for resourceType, synced := range d.synced {
+		status[resourceType] = synced
+	}
+	return status
+}
+
+// crdGVR returns the resource served by an established CRD whose group
+// matches one of the configured patterns, using its storage version. d.mu
+// must be held.
+func (d *dynamicWatcher) crdGVR(crd *unstructured.Unstructured) (schema.GroupVersionResource, bool) {
+	group, _, _ := unstructured.NestedString(crd.Object, "spec", "group")
+	plural, _, _ := unstructured.NestedString(crd.Object, "spec", "names", "plural")
+	if group == "" || plural == "" || !matchesAny(d.spec.CRDGroups, group) {
+		return schema.GroupVersionResource{}, false
+	}
+
+	if !crdEstablished(crd) {
+		return schema.GroupVersionResource{}, false
+	}
+
+	versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+	for _, v := range versions {
+		version, ok := v.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		served, _, _ := unstructured.NestedBool(version, "served")
+		storage, _, _ := unstructured.NestedBool(version, "storage")
+		name, _, _ := unstructured.NestedString(version, "name")
+		if served && storage && name != "" {
+			return schema.GroupVersionResource{Group: group, Version: name, Resource: plural}, true
+		}
+	}
+
+	return schema.GroupVersionResource{}, false
+}
+
+func crdEstablished(crd *unstructured.Unstructured) bool {
+	conditions, _, _ := unstructured.NestedSlice(crd.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if ok && condition["type"] == "Established" && condition["status"] == "True" {
+			return true
+		}
+	}
+	return false
+}
+
+// served reports whether discovery lists gvr with the verbs an informer
+// needs, and whether it is namespaced
+func (d *dynamicWatcher) served(gvr schema.GroupVersionResource) (bool, bool, error) {
+	resources, err := d.discovery.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if apierrors.IsNotFound(err) {
+		return false, false, nil
+	}
+	if err != nil {
+		return false, false, err
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == gvr.Resource {
+			return hasVerb(resource.Verbs, "list") && hasVerb(resource.Verbs, "watch"), resource.Namespaced, nil
+		}
+	}
+	return false, false, nil
+}
+
+func hasVerb(verbs []string, verb string) bool {
+	for _, v := range verbs {
+		if v == verb {
+			return true
+		}
+	}
+	return false
+}
+
+// parseGVR parses group/version/resource, or version/resource for the core group
+func parseGVR(s string) (schema.GroupVersionResource, error) {
+	parts := strings.Split(s, "/")
+	switch len(parts) {
+	case 2:
+		return schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}, nil
+	case 3:
+		return schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}, nil
+	}
+	return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q, expected group/version/resource", s)
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, value); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -2,53 +2,542 @@ package watcher
 
 import (
 	"context"
-	"fmt"
+	"log/slog"
+	"strconv"
+	"sync"
+	"sync/atomic"
 	"time"
 
-	"k8s.io/client-go/informers"
+	"github.com/google/uuid"
+	"k8s.io/apimachinery/pkg/api/meta"
 	"k8s.io/client-go/tools/cache"
 
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/sender"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
 )
 
 type resourceWatcherFactory struct {
-	informerFactory informers.SharedInformerFactory
-	sender          *sender.Sender
-	clusterName     string
+	sender      *sender.Sender
+	pipeline    *atomic.Pointer[pipeline]
+	clusterName string
+	scope       scope
+	chunkSize   int
+	log         *slog.Logger
+
+	// Standbys keep every informer running but send nothing, see lead
+	mu        sync.Mutex
+	leading   bool
+	term      int
+	snapshots map[*snapshot]struct{}
+	degraded  map[resourceKey]degradation
 }
 
-func newResourceWatcherFactory(factory informers.SharedInformerFactory, sender *sender.Sender, clusterName string) *resourceWatcherFactory {
+func newResourceWatcherFactory(sender *sender.Sender, pipeline *atomic.Pointer[pipeline], clusterName string, scope scope, chunkSize int, standby bool) *resourceWatcherFactory {
 	return &resourceWatcherFactory{
-		informerFactory: factory,
-		sender:          sender,
-		clusterName:     clusterName,
+		sender:      sender,
+		pipeline:    pipeline,
+		clusterName: clusterName,
+		scope:       scope,
+		chunkSize:   chunkSize,
+		log:         logging.For(logging.ComponentWatcher).With("cluster", clusterName),
+		leading:     !standby,
+		snapshots:   make(map[*snapshot]struct{}),
+		degraded:    make(map[resourceKey]degradation),
 	}
 }
 
-func (f *resourceWatcherFactory) createEventHandlers(resourceType types.ResourceType) cache.ResourceEventHandlerFuncs {
-	return cache.ResourceEventHandlerFuncs{
-		AddFunc: func(obj interface{}) {
-			f.handleResourceEvent(context.Background(), obj, resourceType, types.EventTypeAdd)
+// snapshot collects the initial-list notifications a handler receives and
+// ships them as numbered INITIAL chunks followed by a SNAPSHOT_COMPLETE
+// marker. Because the snapshot and the deltas after it come from the same
+// handler, the backend gets every object exactly once before any change.
+type snapshot struct {
+	resourceType types.ResourceType
+	namespace    string
+	id           string
+	informer     cache.SharedIndexInformer
+
+	mu           sync.Mutex
+	registration cache.ResourceEventHandlerRegistration
+	standby      bool
+	started      time.Time
+	pending      []interface{}
+	chunkIndex   int
+	items        int
+	done         bool
+
+	// resourceVersion is the newest one among the objects in the snapshot
+	resourceVersion string
+
+	// dispatched and handled count the notifications the informer handed
+	// to the handler and those the handler finished, see queueLength
+	dispatched atomic.Int64
+	handled    atomic.Int64
+
+	// sent holds the last payload sent for each object, by UID, when
+	// updates carry patches: the backend holds that version, not the one
+	// the informer had before an update, which may have been suppressed
+	sent map[string]map[string]interface{}
+
+	// listed holds the UIDs resnapshot took from the cache while the
+	// initial list was still being handed to the handler, see addToSnapshot
+	listed map[string]struct{}
+}
+
+// createEventHandlers returns the handler for the informer of resourceType
+// in namespace, empty for all namespaces, and the snapshot it fills. Objects
+// outside the scope are filtered out before they are even counted.
+func (f *resourceWatcherFactory) createEventHandlers(resourceType types.ResourceType, namespace string, informer cache.SharedIndexInformer) (cache.ResourceEventHandler, *snapshot) {
+	f.mu.Lock()
+	snap := &snapshot{
+		resourceType: resourceType,
+		namespace:    namespace,
+		id:           uuid.NewString(),
+		informer:     informer,
+		standby:      !f.leading,
+		started:      time.Now(),
+	}
+	f.snapshots[snap] = struct{}{}
+	f.mu.Unlock()
+
+	handler := cache.ResourceEventHandlerDetailedFuncs{
+		AddFunc: func(obj interface{}, isInInitialList bool) {
+			eventType := types.EventTypeAdd
+			if isInInitialList {
+				eventType = types.EventTypeInitial
+			}
+			defer f.observe(resourceType, eventType)()
+
+			if isInInitialList && f.addToSnapshot(snap, obj) {
+				return
+			}
+			f.deliver(snap, func() {
+				f.handleResourceEvent(context.Background(), snap, obj, types.EventTypeAdd)
+			})
 		},
 		UpdateFunc: func(old, new interface{}) {
-			f.handleResourceEvent(context.Background(), new, resourceType, types.EventTypeUpdate)
+			defer f.observe(resourceType, types.EventTypeUpdate)()
+			f.deliver(snap, func() {
+				f.handleUpdate(snap, old, new)
+			})
 		},
 		DeleteFunc: func(obj interface{}) {
-			f.handleResourceEvent(context.Background(), obj, resourceType, types.EventTypeDelete)
+			defer f.observe(resourceType, types.EventTypeDelete)()
+			f.deliver(snap, func() {
+				f.handleResourceEvent(context.Background(), snap, obj, types.EventTypeDelete)
+			})
+		},
+	}
+
+	filtered := cache.FilteringResourceEventHandler{
+		FilterFunc: func(obj interface{}) bool {
+			return f.scope.allows(resourceType, obj)
 		},
+		Handler: handler,
+	}
+	return countingHandler{ResourceEventHandler: filtered, count: &snap.handled}, snap
+}
+
+// addEventHandler registers handler, as returned by createEventHandlers, on
+// the informer of snap. A second, empty handler counts the notifications
+// the informer hands out; it keeps up with the informer, so the difference
+// to what handler has finished is the backlog queued for it.
+func (f *resourceWatcherFactory) addEventHandler(snap *snapshot, handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	if _, err := snap.informer.AddEventHandler(countingHandler{ResourceEventHandler: cache.ResourceEventHandlerFuncs{}, count: &snap.dispatched}); err != nil {
+		return nil, err
+	}
+	registration, err := snap.informer.AddEventHandler(handler)
+	if err != nil {
+		return nil, err
+	}
+	snap.mu.Lock()
+	snap.registration = registration
+	snap.mu.Unlock()
+	return registration, nil
+}
+
+// queueLength returns the notifications waiting for the handler of snap.
+// The two counts are taken apart, so it is approximate.
+func (snap *snapshot) queueLength() int64 {
+	handled := snap.handled.Load()
+	return max(snap.dispatched.Load()-handled, 0)
+}
+
+// countingHandler counts the notifications handled by the wrapped handler
+type countingHandler struct {
+	cache.ResourceEventHandler
+	count *atomic.Int64
+}
+
+func (h countingHandler) OnAdd(obj interface{}, isInInitialList bool) {
+	h.ResourceEventHandler.OnAdd(obj, isInInitialList)
+	h.count.Add(1)
+}
+
+func (h countingHandler) OnUpdate(old, new interface{}) {
+	h.ResourceEventHandler.OnUpdate(old, new)
+	h.count.Add(1)
+}
+
+func (h countingHandler) OnDelete(obj interface{}) {
+	h.ResourceEventHandler.OnDelete(obj)
+	h.count.Add(1)
+}
+
+// informerStats returns, for every resource type, the objects held in its
+// informer caches and the notifications queued for its handlers, summed
+// over the namespaces of a namespaced scope
+func (f *resourceWatcherFactory) informerStats() (objects, queued map[types.ResourceType]int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	objects = make(map[types.ResourceType]int64)
+	queued = make(map[types.ResourceType]int64)
+	for snap := range f.snapshots {
+		objects[snap.resourceType] += int64(len(snap.informer.GetStore().ListKeys()))
+		queued[snap.resourceType] += snap.queueLength()
 	}
+	return objects, queued
 }
 
-func (f *resourceWatcherFactory) handleResourceEvent(ctx context.Context, obj interface{}, resourceType types.ResourceType, eventType types.EventType) {
-	if err := f.sender.SendResourceEvent(ctx, types.ResourceEvent{
+// observe counts a notification and returns a func recording how long it
+// took to handle
+func (f *resourceWatcherFactory) observe(resourceType types.ResourceType, eventType types.EventType) func() {
+	telemetry.EventsObserved.WithLabelValues(f.clusterName, string(resourceType), string(eventType)).Inc()
+	start := time.Now()
+	return func() {
+		telemetry.EventHandlingDuration.WithLabelValues(f.clusterName, string(resourceType)).Observe(time.Since(start).Seconds())
+	}
+}
+
+// release forgets a snapshot whose informer has been stopped
+func (f *resourceWatcherFactory) release(snap *snapshot) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.snapshots, snap)
+}
+
+// deliver runs send for a delta, completing the snapshot first so deltas
+// always follow it. Nothing is sent while on standby.
+func (f *resourceWatcherFactory) deliver(snap *snapshot, send func()) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	if snap.standby {
+		return
+	}
+	f.finishSnapshot(snap)
+	send()
+}
+
+// addToSnapshot buffers obj as part of the snapshot, flushing a chunk when
+// it is full. It returns false if the snapshot has already been completed.
+// Objects resnapshot already took from the cache are skipped.
+func (f *resourceWatcherFactory) addToSnapshot(snap *snapshot, obj interface{}) bool {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	if snap.standby {
+		return true
+	}
+	if object, err := meta.Accessor(obj); err == nil {
+		if _, ok := snap.listed[string(object.GetUID())]; ok {
+			delete(snap.listed, string(object.GetUID()))
+			return true
+		}
+	}
+	if snap.done {
+		return false
+	}
+	f.bufferSnapshot(snap, obj)
+	return true
+}
+
+func (f *resourceWatcherFactory) bufferSnapshot(snap *snapshot, obj interface{}) {
+	payload, err := f.prepare(snap.resourceType, obj)
+	if err != nil {
+		f.log.Error("failed to add object to snapshot", append(objectAttrs(snap.resourceType, obj), "error", err)...)
+		return
+	}
+
+	snap.pending = append(snap.pending, payload)
+	if object, err := meta.Accessor(obj); err == nil {
+		snap.resourceVersion = newerResourceVersion(snap.resourceVersion, object.GetResourceVersion())
+	}
+	f.remember(snap, payload)
+	if len(snap.pending) >= f.chunkSize {
+		f.flushChunk(snap)
+	}
+}
+
+// completeSnapshot flushes the last chunk and sends the completion marker,
+// unless that already happened or the watcher is on standby
+func (f *resourceWatcherFactory) completeSnapshot(snap *snapshot) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	if snap.standby {
+		return
+	}
+	f.finishSnapshot(snap)
+}
+
+// finishSnapshot does the work of completeSnapshot with snap.mu held. The
+// marker carries the newest resourceVersion among the objects handed to the
+// handler for the snapshot. The informer may already be watching past it,
+// but those changes reach the handler, and the backend, after the marker.
+// An empty snapshot falls back to the informer's.
+func (f *resourceWatcherFactory) finishSnapshot(snap *snapshot) {
+	if snap.done {
+		return
+	}
+	snap.done = true
+	resourceVersion := snap.resourceVersion
+	if resourceVersion == "" {
+		resourceVersion = snap.informer.LastSyncResourceVersion()
+	}
+
+	if len(snap.pending) > 0 || snap.chunkIndex == 0 {
+		f.flushChunk(snap)
+	}
+
+	if err := f.sender.Enqueue(types.ResourceEvent{
+		ClusterName:  f.clusterName,
+		ResourceType: snap.resourceType,
+		EventType:    types.EventTypeSnapshotComplete,
+		Timestamp:    time.Now(),
+		Snapshot: &types.SnapshotInfo{
+			ID:              snap.id,
+			Namespace:       snap.namespace,
+			ChunkIndex:      snap.chunkIndex,
+			ChunkCount:      snap.chunkIndex,
+			ItemCount:       snap.items,
+			ResourceVersion: resourceVersion,
+		},
+	}); err != nil {
+		f.log.Error("failed to spool snapshot completion", "resource_type", snap.resourceType, "snapshot", snap.id, "error", err)
+	}
+	f.log.Info("snapshot complete", "resource_type", snap.resourceType, "snapshot", snap.id,
+		"chunks", snap.chunkIndex, "items", snap.items, "resource_version", resourceVersion)
+
+	telemetry.SnapshotDuration.WithLabelValues(f.clusterName, string(snap.resourceType)).Observe(time.Since(snap.started).Seconds())
+	telemetry.SnapshotItems.WithLabelValues(f.clusterName, string(snap.resourceType)).Set(float64(snap.items))
+}
+
+func (f *resourceWatcherFactory) flushChunk(snap *snapshot) {
+	if err := f.sender.Enqueue(types.ResourceEvent{
+		ClusterName:  f.clusterName,
+		ResourceType: snap.resourceType,
+		EventType:    types.EventTypeInitial,
+		Timestamp:    time.Now(),
+		Payload:      snap.pending,
+		Snapshot: &types.SnapshotInfo{
+			ID:         snap.id,
+			Namespace:  snap.namespace,
+			ChunkIndex: snap.chunkIndex,
+		},
+	}); err != nil {
+		f.log.Error("failed to spool snapshot chunk", "resource_type", snap.resourceType, "snapshot", snap.id, "chunk", snap.chunkIndex, "error", err)
+	}
+
+	snap.items += len(snap.pending)
+	snap.chunkIndex++
+	snap.pending = nil
+}
+
+// lead makes the factory send events until ctx, the leadership term, ends.
+// A standby has dropped everything its informers saw, so every resource
+// type starts over with a fresh snapshot taken from the warm cache, and
+// what is degraded is reported again.
+func (f *resourceWatcherFactory) lead(ctx context.Context) {
+	f.mu.Lock()
+	if ctx.Err() != nil {
+		f.mu.Unlock()
+		return
+	}
+	f.term++
+	term := f.term
+	f.leading = true
+	for snap := range f.snapshots {
+		f.resnapshot(snap)
+	}
+	for key, d := range f.degraded {
+		f.sendStatus(key, types.ResourceStateDegraded, d.reason)
+	}
+	f.mu.Unlock()
+
+	<-ctx.Done()
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// A later term may already have started
+	if f.term != term {
+		return
+	}
+	f.leading = false
+	for snap := range f.snapshots {
+		snap.mu.Lock()
+		snap.standby = true
+		snap.pending = nil
+		snap.sent = nil
+		snap.listed = nil
+		snap.mu.Unlock()
+	}
+}
+
+// resnapshot restarts snap from the contents of its informer cache. Holding
+// snap.mu while listing the cache means every change is either part of the
+// snapshot or delivered after it. The cache may be ahead of the handler
+// while the initial list is handed out, so the objects taken from it are
+// remembered and their queued initial notifications skipped.
+func (f *resourceWatcherFactory) resnapshot(snap *snapshot) {
+	snap.mu.Lock()
+	defer snap.mu.Unlock()
+
+	snap.standby = false
+	snap.id = uuid.NewString()
+	snap.started = time.Now()
+	snap.pending = nil
+	snap.chunkIndex = 0
+	snap.items = 0
+	snap.done = false
+	snap.resourceVersion = ""
+	snap.sent = nil
+	snap.listed = nil
+	if snap.registration == nil || !snap.registration.HasSynced() {
+		snap.listed = make(map[string]struct{})
+	}
+
+	for _, obj := range snap.informer.GetStore().List() {
+		if !f.scope.allows(snap.resourceType, obj) {
+			continue
+		}
+		f.bufferSnapshot(snap, obj)
+		if object, err := meta.Accessor(obj); err == nil && snap.listed != nil {
+			snap.listed[string(object.GetUID())] = struct{}{}
+		}
+	}
+
+	// An informer still listing completes its snapshot once it has synced
+	if snap.informer.HasSynced() {
+		f.finishSnapshot(snap)
+	}
+}
+
+// handleUpdate sends an UPDATE event unless the update is a resync or only
+// touches fields that are slimmed away or ignored for the resource type.
+// The patch, if enabled, is computed between the redacted payload last sent
+// for the object and the new one, so it cannot carry anything the full
+// object would not. Without such a payload, as after a reload enabled
+// patches, the full object is sent instead.
+func (f *resourceWatcherFactory) handleUpdate(snap *snapshot, old, new interface{}) {
+	resourceType := snap.resourceType
+	if sameResourceVersion(old, new) {
+		telemetry.EventsSuppressed.WithLabelValues(f.clusterName, string(resourceType)).Inc()
+		return
+	}
+
+	p := f.pipeline.Load()
+	oldPayload, err := slim(p, resourceType, old)
+	if err != nil {
+		f.log.Error("failed to prepare event", append(objectAttrs(resourceType, old), "event_type", types.EventTypeUpdate, "error", err)...)
+		return
+	}
+	newPayload, err := slim(p, resourceType, new)
+	if err != nil {
+		f.log.Error("failed to prepare event", append(objectAttrs(resourceType, new), "event_type", types.EventTypeUpdate, "error", err)...)
+		return
+	}
+	if !p.slimmer.Changed(resourceType, oldPayload, newPayload) {
+		telemetry.EventsSuppressed.WithLabelValues(f.clusterName, string(resourceType)).Inc()
+		return
+	}
+
+	p.redactor.Redact(newPayload)
+	event := types.ResourceEvent{
+		ClusterName:  f.clusterName,
+		ResourceType: resourceType,
+		EventType:    types.EventTypeUpdate,
+		Timestamp:    time.Now(),
+	}
+	if p.differ.Enabled() {
+		if base, ok := snap.sent[payloadUID(newPayload)]; ok {
+			event.Patch = p.differ.Diff(base, newPayload)
+		}
+	}
+	if p.differ.IncludeObject() || event.Patch == nil {
+		event.Payload = newPayload
+	}
+
+	attrs := append(objectAttrs(resourceType, new), "event_type", types.EventTypeUpdate)
+	if err := f.sender.Enqueue(event); err != nil {
+		f.log.Error("failed to spool event", append(attrs, "error", err)...)
+		return
+	}
+	f.remember(snap, newPayload)
+	f.log.Debug("spooled event", attrs...)
+}
+
+func (f *resourceWatcherFactory) handleResourceEvent(ctx context.Context, snap *snapshot, obj interface{}, eventType types.EventType) {
+	resourceType := snap.resourceType
+	payload, err := f.prepare(resourceType, obj)
+	if err != nil {
+		f.log.Error("failed to prepare event", append(objectAttrs(resourceType, obj), "event_type", eventType, "error", err)...)
+		return
+	}
+
+	if err := f.sender.Enqueue(types.ResourceEvent{
 		ClusterName:  f.clusterName,
 		ResourceType: resourceType,
 		EventType:    eventType,
 		Timestamp:    time.Now(),
-		Payload:      obj,
+		Payload:      payload,
 	}); err != nil {
-		// Use structured logging here
-		fmt.Printf("failed to send %s %s event: %v\n", resourceType, eventType, err)
+		f.log.Error("failed to spool event", append(objectAttrs(resourceType, obj), "event_type", eventType, "error", err)...)
+		return
+	}
+	if eventType == types.EventTypeDelete {
+		delete(snap.sent, payloadUID(payload))
+	} else {
+		f.remember(snap, payload)
+	}
+	f.log.Debug("spooled event", append(objectAttrs(resourceType, obj), "event_type", eventType)...)
+}
+
+// remember records payload as the version of its object the backend holds,
+// the base of the next patch. Nothing is kept while patches are disabled.
+// Must be called with snap.mu held.
+func (f *resourceWatcherFactory) remember(snap *snapshot, payload map[string]interface{}) {
+	if !f.pipeline.Load().differ.Enabled() {
+		snap.sent = nil
+		return
 	}
+	if snap.sent == nil {
+		snap.sent = make(map[string]map[string]interface{})
+	}
+	snap.sent[payloadUID(payload)] = payload
+}
+
+// newerResourceVersion returns the newer of two resourceVersions. They are
+// opaque to clients, but the API server issues increasing integers; should
+// one not parse, next is taken as the newer.
+func newerResourceVersion(current, next string) string {
+	if next == "" {
+		return current
+	}
+	a, errA := strconv.ParseUint(current, 10, 64)
+	b, errB := strconv.ParseUint(next, 10, 64)
+	if errA == nil && errB == nil && a > b {
+		return current
+	}
+	return next
+}
+
+// payloadUID returns the metadata.uid of payload
+func payloadUID(payload map[string]interface{}) string {
+	metadata, _ := payload["metadata"].(map[string]interface{})
+	uid, _ := metadata["uid"].(string)
+	return uid
 }
@@ -0,0 +1,197 @@
+package watcher
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/client-go/rest"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/kube"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
+)
+
+// Reload applies a changed configuration to the running watcher: field
+// rules, patches and redaction, sender batching, log levels, dynamic
+// resources, the configured clusters, the scope and the built-in resource
+// types. A changed scope or set of resource types restarts the watch of
+// every cluster, which ships fresh snapshots of what is now watched. Everything that can fail is
+// prepared before anything is applied, so a rejected config changes
+// nothing. Settings that only take effect on restart are logged.
+func (w *Watcher) Reload(cfg *config.Config) error {
+	w.reloadMu.Lock()
+	defer w.reloadMu.Unlock()
+
+	previous := w.current.Load()
+
+	transforms, err := newPipeline(cfg)
+	if err != nil {
+		return err
+	}
+
+	added, removed, err := w.diffClusters(previous, cfg)
+	if err != nil {
+		return err
+	}
+
+	if err := logging.SetLevels(cfg); err != nil {
+		return fmt.Errorf("failed to set log levels: %w", err)
+	}
+
+	w.pipeline.Store(transforms)
+	w.sender.SetBatch(cfg.Sender.Batch)
+
+	w.mu.Lock()
+	w.current.Store(cfg)
+	clusters := make([]*clusterWatcher, 0, len(w.clusters))
+	for _, cluster := range w.clusters {
+		clusters = append(clusters, cluster)
+	}
+	w.mu.Unlock()
+
+	for _, cluster := range clusters {
+		cluster.dynamic.configure(cfg.Kubernetes.Dynamic)
+	}
+
+	for _, name := range removed {
+		w.RemoveCluster(name)
+	}
+	for name, restConfig := range added {
+		if err := w.AddCluster(name, restConfig); err != nil {
+			w.log.Error("failed to add cluster", "cluster", name, "error", err)
+		}
+	}
+
+	// Informers are bound to their namespaces and selectors when created,
+	// and handlers registered on the included resource types at startup
+	if !reflect.DeepEqual(previous.Kubernetes.Scope, cfg.Kubernetes.Scope) || !reflect.DeepEqual(previous.Kubernetes.Resources, cfg.Kubernetes.Resources) {
+		for _, cluster := range clusters {
+			if _, ok := added[cluster.name]; ok {
+				continue
+			}
+			if err := w.restartCluster(cluster); err != nil {
+				w.log.Error("failed to restart cluster with the new scope", "cluster", cluster.name, "error", err)
+			}
+		}
+	}
+
+	for _, setting := range restartRequired(previous, cfg) {
+		w.log.Warn("config change takes effect after a restart", "setting", setting)
+	}
+	return nil
+}
+
+// restartCluster watches cluster again from scratch under the current
+// config, unless it has been removed meanwhile
+func (w *Watcher) restartCluster(cluster *clusterWatcher) error {
+	w.mu.RLock()
+	watched := w.clusters[cluster.name] == cluster
+	w.mu.RUnlock()
+	if !watched {
+		return nil
+	}
+
+	w.RemoveCluster(cluster.name)
+	w.log.Info("restarting cluster watch", "cluster", cluster.name)
+	return w.AddCluster(cluster.name, cluster.restConfig)
+}
+
+// diffClusters compares the configured clusters of two configs. It returns
+// the clusters to start with their connection, and the ones to stop; a
+// cluster whose connection changed is in both. Clusters added from secrets
+// are left alone.
+func (w *Watcher) diffClusters(previous, cfg *config.Config) (map[string]*rest.Config, []string, error) {
+	if !MultiCluster(previous) || !MultiCluster(cfg) {
+		return nil, nil, nil
+	}
+
+	before := make(map[string]config.Connection, len(previous.Kubernetes.Clusters))
+	for _, cluster := range previous.Kubernetes.Clusters {
+		before[clusterName(cluster)] = cluster.Connection
+	}
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	added := make(map[string]*rest.Config)
+	var removed []string
+	after := make(map[string]bool, len(cfg.Kubernetes.Clusters))
+	for _, cluster := range cfg.Kubernetes.Clusters {
+		name := clusterName(cluster)
+		after[name] = true
+
+		conn, existed := before[name]
+		if existed && reflect.DeepEqual(conn, cluster.Connection) {
+			continue
+		}
+		if _, watched := w.clusters[name]; watched && !existed {
+			return nil, nil, fmt.Errorf("cluster %s is already watched", name)
+		}
+
+		restConfig, err := kube.RESTConfig(w.inherit(cluster.Connection))
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to create kubernetes config for cluster %s: %w", name, err)
+		}
+		added[name] = restConfig
+		if existed {
+			removed = append(removed, name)
+		}
+	}
+
+	for name := range before {
+		if !after[name] {
+			removed = append(removed, name)
+		}
+	}
+	return added, removed, nil
+}
+
+// MultiCluster reports whether cfg watches configured or secret clusters
+// instead of the cluster the agent connects to
+func MultiCluster(cfg *config.Config) bool {
+	return len(cfg.Kubernetes.Clusters) > 0 || cfg.Kubernetes.ClusterSecrets.Namespace != ""
+}
+
+// clusterName is the name a configured cluster is watched under
+func clusterName(cluster config.Cluster) string {
+	if cluster.Name != "" {
+		return cluster.Name
+	}
+	return cluster.Context
+}
+
+// restartRequired lists the settings that differ between two configs but
+// are only read at startup
+func restartRequired(previous, cfg *config.Config) []string {
+	settings := []struct {
+		key           string
+		before, after interface{}
+	}{
+		{"mode", previous.Mode, cfg.Mode},
+		{"reload", previous.Reload, cfg.Reload},
+		{"server", previous.Server, cfg.Server},
+		{"api", previous.API, cfg.API},
+		{"kubernetes connection", previous.Kubernetes.Connection, cfg.Kubernetes.Connection},
+		{"kubernetes.cluster_name", previous.Kubernetes.ClusterName, cfg.Kubernetes.ClusterName},
+		{"kubernetes.snapshot_chunk_size", previous.Kubernetes.SnapshotChunkSize, cfg.Kubernetes.SnapshotChunkSize},
+		{"kubernetes.dynamic.discovery_interval", previous.Kubernetes.Dynamic.DiscoveryInterval, cfg.Kubernetes.Dynamic.DiscoveryInterval},
+		{"kubernetes.cluster_secrets", previous.Kubernetes.ClusterSecrets, cfg.Kubernetes.ClusterSecrets},
+		{"leader_election", previous.LeaderElection, cfg.LeaderElection},
+		{"log.format", previous.Log.Format, cfg.Log.Format},
+		{"sender.spool", previous.Sender.Spool, cfg.Sender.Spool},
+		{"sender.retry", previous.Sender.Retry, cfg.Sender.Retry},
+		{"sender.breaker", previous.Sender.Breaker, cfg.Sender.Breaker},
+		{"sender.drain_timeout", previous.Sender.DrainTimeout, cfg.Sender.DrainTimeout},
+	}
+
+	var keys []string
+	for _, s := range settings {
+		if !reflect.DeepEqual(s.before, s.after) {
+			keys = append(keys, s.key)
+		}
+	}
+	if MultiCluster(previous) != MultiCluster(cfg) {
+		keys = append(keys, "kubernetes.clusters")
+	}
+	return keys
+}
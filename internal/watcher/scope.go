@@ -0,0 +1,93 @@
+package watcher
+
+import (
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers/internalinterfaces"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// scope decides which objects of a cluster are watched, see config.Scope.
+// Selectors and exact namespaces are applied by the API server; namespace
+// patterns cannot be expressed that way and are matched by allows.
+// Built-in resource types left out of kubernetes.resources are not watched.
+type scope struct {
+	cfg       config.Scope
+	resources []string
+}
+
+func newScope(cfg *config.Config) scope {
+	return scope{cfg: cfg.Kubernetes.Scope, resources: cfg.Kubernetes.Resources}
+}
+
+// namespaces returns the namespaces to run informers in, all of them
+// unless the scope is namespaced
+func (s scope) namespaces() []string {
+	if s.cfg.Namespaced() {
+		return s.cfg.Namespaces
+	}
+	return []string{metav1.NamespaceAll}
+}
+
+// watches reports whether a resource is watched at all. Cluster-scoped
+// resources are not when the scope is namespaced, listing them would need
+// a ClusterRole.
+func (s scope) watches(namespaced bool) bool {
+	return namespaced || !s.cfg.Namespaced()
+}
+
+// includes reports whether the built-in resourceType is watched, which
+// all of them are unless kubernetes.resources lists some
+func (s scope) includes(resourceType types.ResourceType) bool {
+	if len(s.resources) == 0 {
+		return true
+	}
+	for _, r := range s.resources {
+		if r == string(resourceType) {
+			return true
+		}
+	}
+	return false
+}
+
+// tweak returns the list options tweak applying the selectors of
+// resourceType, or nil if it has none
+func (s scope) tweak(resourceType types.ResourceType) internalinterfaces.TweakListOptionsFunc {
+	selectors := s.cfg.SelectorsFor(string(resourceType))
+	if selectors.LabelSelector == "" && selectors.FieldSelector == "" {
+		return nil
+	}
+	return func(options *metav1.ListOptions) {
+		options.LabelSelector = selectors.LabelSelector
+		options.FieldSelector = selectors.FieldSelector
+	}
+}
+
+// allows reports whether obj is in one of the watched namespaces. Namespace
+// objects are matched by their name, other cluster-scoped objects are
+// always allowed.
+func (s scope) allows(resourceType types.ResourceType, obj interface{}) bool {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	object, err := meta.Accessor(obj)
+	if err != nil {
+		return true
+	}
+
+	namespace := object.GetNamespace()
+	if resourceType == types.TypeNamespace {
+		namespace = object.GetName()
+	}
+	if namespace == "" {
+		return true
+	}
+
+	if len(s.cfg.Namespaces) > 0 && !matchesAny(s.cfg.Namespaces, namespace) {
+		return false
+	}
+	return !matchesAny(s.cfg.ExcludeNamespaces, namespace)
+}
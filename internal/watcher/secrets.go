@@ -0,0 +1,111 @@
+package watcher
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	clusterSecretKey        = "kubeconfig"
+	clusterNameAnnotation   = "skyflo.ai/cluster-name"
+	clusterSecretResyncTime = time.Hour
+)
+
+// clusterSecrets adds and removes clusters as their Secrets come and go
+type clusterSecrets struct {
+	w *Watcher
+
+	mu sync.Mutex
+	// clusters maps a Secret to the cluster it added, so a Secret never
+	// removes a cluster that was configured some other way
+	clusters map[string]string
+}
+
+// watchClusterSecrets watches the cluster secrets of the home cluster until
+// ctx is cancelled
+func (w *Watcher) watchClusterSecrets(ctx context.Context) error {
+	cs := &clusterSecrets{w: w, clusters: make(map[string]string)}
+
+	factory := informers.NewSharedInformerFactoryWithOptions(w.client, clusterSecretResyncTime,
+		informers.WithNamespace(w.cfg.Kubernetes.ClusterSecrets.Namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = w.cfg.Kubernetes.ClusterSecrets.Selector
+		}),
+	)
+	defer factory.Shutdown()
+
+	informer := factory.Core().V1().Secrets().Informer()
+	if _, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			cs.add(obj.(*corev1.Secret))
+		},
+		UpdateFunc: func(old, new interface{}) {
+			oldSecret, newSecret := old.(*corev1.Secret), new.(*corev1.Secret)
+			if oldSecret.ResourceVersion == newSecret.ResourceVersion {
+				return
+			}
+			cs.remove(oldSecret)
+			cs.add(newSecret)
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if secret, ok := obj.(*corev1.Secret); ok {
+				cs.remove(secret)
+			}
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to add cluster secret event handler: %w", err)
+	}
+
+	factory.Start(ctx.Done())
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (cs *clusterSecrets) add(secret *corev1.Secret) {
+	name := secret.Name
+	if annotated := secret.Annotations[clusterNameAnnotation]; annotated != "" {
+		name = annotated
+	}
+
+	restConfig, err := clientcmd.RESTConfigFromKubeConfig(secret.Data[clusterSecretKey])
+	if err != nil {
+		cs.w.log.Error("ignoring cluster secret", "namespace", secret.Namespace, "name", secret.Name, "error", err)
+		return
+	}
+	restConfig.QPS = cs.w.cfg.Kubernetes.QPS
+	restConfig.Burst = cs.w.cfg.Kubernetes.Burst
+
+	if err := cs.w.AddCluster(name, restConfig); err != nil {
+		cs.w.log.Error("ignoring cluster secret", "namespace", secret.Namespace, "name", secret.Name, "error", err)
+		return
+	}
+	cs.w.log.Info("watching cluster from secret", "cluster", name, "namespace", secret.Namespace, "name", secret.Name)
+
+	cs.mu.Lock()
+	cs.clusters[secret.Namespace+"/"+secret.Name] = name
+	cs.mu.Unlock()
+}
+
+func (cs *clusterSecrets) remove(secret *corev1.Secret) {
+	key := secret.Namespace + "/" + secret.Name
+
+	cs.mu.Lock()
+	name, ok := cs.clusters[key]
+	delete(cs.clusters, key)
+	cs.mu.Unlock()
+
+	if ok {
+		cs.w.RemoveCluster(name)
+	}
+}
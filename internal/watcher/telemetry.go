@@ -0,0 +1,58 @@
+package watcher
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
+)
+
+var (
+	informerObjectsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(telemetry.Namespace, "", "informer_objects"),
+		"Objects held in the informer cache of a resource type.",
+		[]string{"cluster", "resource_type"}, nil,
+	)
+
+	informerQueueDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(telemetry.Namespace, "", "informer_queue_length"),
+		"Informer notifications of a resource type waiting to be handled.",
+		[]string{"cluster", "resource_type"}, nil,
+	)
+)
+
+// informerCollector reports the cache size and handler backlog of every
+// informer of every watched cluster at scrape time
+type informerCollector struct {
+	w *Watcher
+}
+
+// Collector returns a Prometheus collector for the watcher's informers
+func (w *Watcher) Collector() prometheus.Collector {
+	return informerCollector{w: w}
+}
+
+func (c informerCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- informerObjectsDesc
+	ch <- informerQueueDesc
+}
+
+func (c informerCollector) Collect(ch chan<- prometheus.Metric) {
+	c.w.mu.RLock()
+	clusters := make([]*clusterWatcher, 0, len(c.w.clusters))
+	for _, cluster := range c.w.clusters {
+		clusters = append(clusters, cluster)
+	}
+	c.w.mu.RUnlock()
+
+	for _, cluster := range clusters {
+		objects, queued := cluster.factory.informerStats()
+		for resourceType, count := range objects {
+			ch <- prometheus.MustNewConstMetric(informerObjectsDesc, prometheus.GaugeValue,
+				float64(count), cluster.name, string(resourceType))
+		}
+		for resourceType, count := range queued {
+			ch <- prometheus.MustNewConstMetric(informerQueueDesc, prometheus.GaugeValue,
+				float64(count), cluster.name, string(resourceType))
+		}
+	}
+}
@@ -0,0 +1,114 @@
+package watcher
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/redact"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/transform"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// pipeline holds the transforms applied to every payload. A reload swaps
+// it as a whole, so each event goes through a single version of the rules.
+type pipeline struct {
+	slimmer  *transform.Slimmer
+	differ   *transform.Differ
+	redactor *redact.Redactor
+}
+
+func newPipeline(cfg *config.Config) (*pipeline, error) {
+	slimmer, err := transform.NewSlimmer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create slimmer: %w", err)
+	}
+
+	differ, err := transform.NewDiffer(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create differ: %w", err)
+	}
+
+	redactor, err := redact.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create redactor: %w", err)
+	}
+
+	return &pipeline{slimmer: slimmer, differ: differ, redactor: redactor}, nil
+}
+
+// prepare turns an object handed out by an informer into the payload that
+// is sent to the backend
+func (f *resourceWatcherFactory) prepare(resourceType types.ResourceType, obj interface{}) (map[string]interface{}, error) {
+	p := f.pipeline.Load()
+	payload, err := slim(p, resourceType, obj)
+	if err != nil {
+		return nil, err
+	}
+	p.redactor.Redact(payload)
+	return payload, nil
+}
+
+// slim converts obj to a fresh unstructured copy, so nothing below ever
+// touches the informer cache, and drops the fields the backend does not need
+func slim(p *pipeline, resourceType types.ResourceType, obj interface{}) (map[string]interface{}, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	var payload map[string]interface{}
+	switch o := obj.(type) {
+	case *unstructured.Unstructured:
+		payload = runtime.DeepCopyJSON(o.Object)
+	case runtime.Object:
+		var err error
+		if payload, err = runtime.DefaultUnstructuredConverter.ToUnstructured(o); err != nil {
+			return nil, fmt.Errorf("failed to convert %s: %w", resourceType, err)
+		}
+		// Typed informers drop the apiVersion and kind the redactor goes by
+		kinds, _, err := scheme.Scheme.ObjectKinds(o)
+		if err != nil {
+			return nil, fmt.Errorf("failed to determine kind of %s: %w", resourceType, err)
+		}
+		payload["apiVersion"], payload["kind"] = kinds[0].ToAPIVersionAndKind()
+	default:
+		return nil, fmt.Errorf("unexpected %s object of type %T", resourceType, obj)
+	}
+
+	return p.slimmer.Slim(resourceType, payload), nil
+}
+
+// sameResourceVersion reports whether an update is an informer resync,
+// which redelivers an object at the resourceVersion already seen
+func sameResourceVersion(old, new interface{}) bool {
+	oldMeta, err := meta.Accessor(old)
+	if err != nil {
+		return false
+	}
+	newMeta, err := meta.Accessor(new)
+	if err != nil {
+		return false
+	}
+	return oldMeta.GetResourceVersion() == newMeta.GetResourceVersion()
+}
+
+// objectAttrs are the log attributes identifying obj
+func objectAttrs(resourceType types.ResourceType, obj interface{}) []any {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+
+	attrs := []any{"resource_type", resourceType}
+	if object, err := meta.Accessor(obj); err == nil {
+		if namespace := object.GetNamespace(); namespace != "" {
+			attrs = append(attrs, "namespace", namespace)
+		}
+		attrs = append(attrs, "name", object.GetName(), "resource_version", object.GetResourceVersion())
+	}
+	return attrs
+}
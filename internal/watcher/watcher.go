@@ -3,32 +3,57 @@ package watcher
 import (
 	"context"
 	"fmt"
+	"log/slog"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"k8s.io/client-go/informers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
 
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/kube"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/sender"
-	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
 )
 
+// Watcher watches one or more clusters and ships their events through a
+// single sender. The cluster it connects to itself (the home cluster) holds
+// the leader election lease and the cluster secrets.
 type Watcher struct {
-	cfg             *config.Config
-	client          kubernetes.Interface
-	sender          *sender.Sender
-	informerFactory informers.SharedInformerFactory
-	factory         *resourceWatcherFactory
-	healthy         bool
-	mu              sync.RWMutex
+	cfg        *config.Config
+	client     kubernetes.Interface
+	restConfig *rest.Config
+	sender     *sender.Sender
+
+	// pipeline is shared by the factories of every cluster
+	pipeline atomic.Pointer[pipeline]
+
+	// current is the config last applied by Reload, see there for what
+	// it can change. cfg stays the one the watcher was started with.
+	current  atomic.Pointer[config.Config]
+	reloadMu sync.Mutex
+
+	// home names the watched cluster that is the home cluster, empty if
+	// only configured or secret clusters are watched
+	home string
+
+	mu        sync.RWMutex
+	ctx       context.Context
+	leaderCtx context.Context
+	clusters  map[string]*clusterWatcher
+	running   bool
+	log       *slog.Logger
 }
 
 func New(cfg *config.Config) (*Watcher, error) {
-	k8sConfig, err := rest.InClusterConfig()
+	k8sConfig, err := kube.RESTConfig(cfg.Kubernetes.Connection)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create in-cluster config: %w", err)
+		return nil, fmt.Errorf("failed to create kubernetes config: %w", err)
 	}
 
 	clientset, err := kubernetes.NewForConfig(k8sConfig)
@@ -36,116 +61,326 @@ func New(cfg *config.Config) (*Watcher, error) {
 		return nil, fmt.Errorf("failed to create clientset: %w", err)
 	}
 
-	informerFactory := informers.NewSharedInformerFactory(clientset, time.Hour*24)
-	sender := sender.New(cfg)
+	sender, err := sender.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sender: %w", err)
+	}
+
+	transforms, err := newPipeline(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &Watcher{
+		cfg:        cfg,
+		client:     clientset,
+		restConfig: k8sConfig,
+		sender:     sender,
+		clusters:   make(map[string]*clusterWatcher),
+		log:        logging.For(logging.ComponentWatcher),
+	}
+	w.pipeline.Store(transforms)
+	w.current.Store(cfg)
+
+	if !MultiCluster(cfg) {
+		w.home = cfg.Kubernetes.ClusterName
+		if err := w.AddCluster(cfg.Kubernetes.ClusterName, k8sConfig); err != nil {
+			return nil, err
+		}
+		return w, nil
+	}
+
+	for _, cluster := range cfg.Kubernetes.Clusters {
+		name := clusterName(cluster)
+		if name == "" {
+			return nil, fmt.Errorf("cluster needs a name or a context")
+		}
+
+		restConfig, err := kube.RESTConfig(w.inherit(cluster.Connection))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create kubernetes config for cluster %s: %w", name, err)
+		}
+		if err := w.AddCluster(name, restConfig); err != nil {
+			return nil, err
+		}
+	}
 
-	return &Watcher{
-		cfg:             cfg,
-		client:          clientset,
-		sender:          sender,
-		informerFactory: informerFactory,
-		factory:         newResourceWatcherFactory(informerFactory, sender, cfg.Kubernetes.ClusterName),
-	}, nil
+	return w, nil
 }
 
+// inherit fills in the connection settings a cluster leaves empty from the
+// home cluster, so contexts in the same kubeconfig only need naming
+func (w *Watcher) inherit(conn config.Connection) config.Connection {
+	home := w.cfg.Kubernetes.Connection
+	if conn.Kubeconfig == "" && conn.Context != "" {
+		conn.Kubeconfig = home.Kubeconfig
+	}
+	if conn.QPS == 0 {
+		conn.QPS = home.QPS
+	}
+	if conn.Burst == 0 {
+		conn.Burst = home.Burst
+	}
+	return conn
+}
+
+// Run watches every cluster until ctx is cancelled, then shuts down
+// gracefully, see shutdown
 func (w *Watcher) Run(ctx context.Context) error {
 	defer func() {
 		w.mu.Lock()
-		w.healthy = false
+		w.running = false
 		w.mu.Unlock()
 	}()
 
+	// Drain spooled events, including any left over from a previous run
+	senderDone := make(chan struct{})
+	go func() {
+		defer close(senderDone)
+		w.sender.Run(ctx)
+	}()
+	defer w.shutdown(senderDone)
+
 	w.mu.Lock()
-	w.healthy = true
+	w.ctx = ctx
+	w.running = true
+	for _, cluster := range w.clusters {
+		w.startCluster(cluster)
+	}
 	w.mu.Unlock()
 
-	// Start informer factory
-	w.informerFactory.Start(ctx.Done())
+	if w.cfg.Kubernetes.ClusterSecrets.Namespace != "" {
+		go func() {
+			if err := w.watchClusterSecrets(ctx); err != nil && ctx.Err() == nil {
+				w.log.Error("cluster secret watcher failed", "error", err)
+			}
+		}()
+	}
+
+	if w.cfg.LeaderElection.Enabled {
+		return w.runLeaderElection(ctx)
+	}
+
+	<-ctx.Done()
+	return ctx.Err()
+}
 
-	// Wait for initial sync
-	cachesSynced := w.informerFactory.WaitForCacheSync(ctx.Done())
-	for _, synced := range cachesSynced {
-		if !synced {
-			return fmt.Errorf("failed to sync caches")
+// shutdown stops the informers of every cluster so no new events arrive,
+// then gives the sender up to the drain timeout to deliver what is spooled.
+// Events it cannot deliver in time stay in the spool for the next start.
+func (w *Watcher) shutdown(senderDone <-chan struct{}) {
+	w.mu.RLock()
+	clusters := make([]*clusterWatcher, 0, len(w.clusters))
+	for _, cluster := range w.clusters {
+		clusters = append(clusters, cluster)
+	}
+	w.mu.RUnlock()
+
+	for _, cluster := range clusters {
+		if cluster.cancel != nil {
+			cluster.cancel()
+			<-cluster.done
 		}
 	}
+	<-senderDone
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.cfg.Sender.DrainTimeout)
+	defer cancel()
 
-	// Initial resource crawl
-	if err := w.initialCrawl(ctx); err != nil {
-		return fmt.Errorf("initial crawl failed: %w", err)
+	flushed, err := w.sender.Drain(ctx)
+	if err != nil {
+		w.log.Warn("drain interrupted", "error", err)
+	}
+	spooled, err := w.sender.Pending()
+	if err != nil {
+		w.log.Error("failed to count spooled events", "error", err)
 	}
+	if err := w.sender.Close(); err != nil {
+		w.log.Error("failed to close sender", "error", err)
+	}
+	w.log.Info("shut down", "flushed", flushed, "spooled", spooled)
+}
 
-	// Setup watchers
-	w.setupWatchers()
+// AddCluster starts watching a cluster under name, which is stamped on all
+// of its events. Clusters can be added before and while the watcher runs.
+func (w *Watcher) AddCluster(name string, restConfig *rest.Config) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
 
-	<-ctx.Done()
-	return ctx.Err()
+	if _, ok := w.clusters[name]; ok {
+		return fmt.Errorf("cluster %s is already watched", name)
+	}
+
+	cluster, err := newClusterWatcher(w, name, restConfig)
+	if err != nil {
+		return fmt.Errorf("failed to create watcher for cluster %s: %w", name, err)
+	}
+	w.clusters[name] = cluster
+
+	if w.ctx != nil {
+		w.startCluster(cluster)
+	}
+	return nil
 }
 
-func (w *Watcher) setupWatchers() {
-	// Setup informers with the factory's event handlers
-	w.informerFactory.Core().V1().Nodes().Informer().AddEventHandler(
-		w.factory.createEventHandlers(types.TypeNode))
-	// Add other resources similarly...
+// RemoveCluster stops watching a cluster and waits for its informers to stop
+func (w *Watcher) RemoveCluster(name string) {
+	w.mu.Lock()
+	cluster, ok := w.clusters[name]
+	delete(w.clusters, name)
+	w.mu.Unlock()
+
+	if !ok || cluster.cancel == nil {
+		return
+	}
+	cluster.cancel()
+	<-cluster.done
+	w.log.Info("stopped watching cluster", "cluster", name)
 }
 
-func (w *Watcher) IsHealthy() bool {
-	w.mu.RLock()
-	defer w.mu.RUnlock()
-	return w.healthy
+// startCluster runs cluster in the background. w.mu must be held.
+func (w *Watcher) startCluster(cluster *clusterWatcher) {
+	ctx, cancel := context.WithCancel(w.ctx)
+	cluster.cancel = cancel
+
+	go func() {
+		defer close(cluster.done)
+		if err := cluster.run(ctx); err != nil && ctx.Err() == nil {
+			w.log.Error("cluster watcher failed", "cluster", cluster.name, "error", err)
+		}
+	}()
+
+	if w.leaderCtx != nil && w.leaderCtx.Err() == nil {
+		go cluster.factory.lead(w.leaderCtx)
+	}
 }
 
-func (w *Watcher) initialCrawl(ctx context.Context) error {
-	// Get initial state of all resources
-	if err := w.crawlNodes(ctx); err != nil {
-		return err
+// runLeaderElection campaigns for the lease until ctx is cancelled. The
+// informers keep running on a standby, so a new leader only has to ship a
+// snapshot from its cache instead of listing everything again.
+func (w *Watcher) runLeaderElection(ctx context.Context) error {
+	identity := w.cfg.LeaderElection.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return fmt.Errorf("failed to determine leader election identity: %w", err)
+		}
+		identity = hostname
 	}
-	if err := w.crawlNamespaces(ctx); err != nil {
-		return err
+
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      w.cfg.LeaderElection.LeaseName,
+			Namespace: w.cfg.LeaderElection.LeaseNamespace,
+		},
+		Client:     w.client.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: identity},
 	}
-	if err := w.crawlIngresses(ctx); err != nil {
-		return err
+
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		Name:            w.cfg.LeaderElection.LeaseName,
+		LeaseDuration:   w.cfg.LeaderElection.LeaseDuration,
+		RenewDeadline:   w.cfg.LeaderElection.RenewDeadline,
+		RetryPeriod:     w.cfg.LeaderElection.RetryPeriod,
+		ReleaseOnCancel: true,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(ctx context.Context) {
+				w.log.Info("acquired lease, sending events", "identity", identity, "namespace", lock.LeaseMeta.Namespace, "lease", lock.LeaseMeta.Name)
+				w.lead(ctx)
+			},
+			OnStoppedLeading: func() {
+				w.log.Info("on standby", "identity", identity)
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create leader elector: %w", err)
 	}
-	if err := w.crawlServices(ctx); err != nil {
-		return err
+
+	// Run returns whenever the lease is lost; campaign again as a standby
+	for ctx.Err() == nil {
+		elector.Run(ctx)
 	}
-	if err := w.crawlDeployments(ctx); err != nil {
-		return err
+	return ctx.Err()
+}
+
+// lead makes every cluster send events for the leadership term ctx
+func (w *Watcher) lead(ctx context.Context) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.leaderCtx = ctx
+	for _, cluster := range w.clusters {
+		go cluster.factory.lead(ctx)
 	}
-	if err := w.crawlStatefulSets(ctx); err != nil {
-		return err
+}
+
+// isLeading reports whether this replica is sending events
+func (w *Watcher) isLeading() bool {
+	if !w.cfg.LeaderElection.Enabled {
+		return true
 	}
-	if err := w.crawlPods(ctx); err != nil {
-		return err
+
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.leaderCtx != nil && w.leaderCtx.Err() == nil
+}
+
+// IsHealthy reports whether the watcher is running and ready, see Health
+func (w *Watcher) IsHealthy() bool {
+	return w.Health().Ready
+}
+
+// Health is a point-in-time view of the watcher and its sender. Live is set
+// while Run is running. Ready additionally needs the sender to be able to
+// reach the parent server and, if the home cluster is watched, that to
+// have shipped its initial snapshot. Other clusters come and go with
+// secrets and config, so one that is unreachable does not make the agent
+// unready; Clusters tells each one's state. AuthFailed is set while the
+// server rejects the API key.
+type Health struct {
+	Live       bool                     `json:"live"`
+	Ready      bool                     `json:"ready"`
+	Leader     bool                     `json:"leader"`
+	Breaker    sender.BreakerState      `json:"breaker"`
+	AuthFailed bool                     `json:"auth_failed,omitempty"`
+	SpoolDepth int64                    `json:"spool_depth"`
+	LastSend   *time.Time               `json:"last_send,omitempty"`
+	Clusters   map[string]ClusterHealth `json:"clusters"`
+}
+
+func (w *Watcher) Health() Health {
+	w.mu.RLock()
+	running := w.running
+	clusters := make(map[string]*clusterWatcher, len(w.clusters))
+	for name, cluster := range w.clusters {
+		clusters[name] = cluster
 	}
-	if err := w.crawlConfigMaps(ctx); err != nil {
-		return err
+	w.mu.RUnlock()
+
+	health := Health{
+		Live:       running,
+		Ready:      running,
+		Leader:     w.isLeading(),
+		Breaker:    w.sender.BreakerState(),
+		AuthFailed: w.sender.AuthFailed(),
+		SpoolDepth: w.sender.SpoolDepth(),
+		Clusters:   make(map[string]ClusterHealth, len(clusters)),
 	}
-	if err := w.crawlSecrets(ctx); err != nil {
-		return err
+	if lastSend := w.sender.LastSend(); !lastSend.IsZero() {
+		health.LastSend = &lastSend
+	}
+	if health.Breaker == sender.BreakerOpen {
+		health.Ready = false
 	}
-	return nil
-}
 
-func (w *Watcher) watchResources(ctx context.Context) error {
-	errCh := make(chan error, 9) // One for each resource type
-
-	// Start watchers for each resource type
-	go w.watchNodes(ctx, errCh)
-	go w.watchNamespaces(ctx, errCh)
-	go w.watchIngresses(ctx, errCh)
-	go w.watchServices(ctx, errCh)
-	go w.watchDeployments(ctx, errCh)
-	go w.watchStatefulSets(ctx, errCh)
-	go w.watchPods(ctx, errCh)
-	go w.watchConfigMaps(ctx, errCh)
-	go w.watchSecrets(ctx, errCh)
-
-	// Wait for any error or context cancellation
-	select {
-	case err := <-errCh:
-		return err
-	case <-ctx.Done():
-		return ctx.Err()
+	for name, cluster := range clusters {
+		clusterHealth := cluster.health()
+		health.Clusters[name] = clusterHealth
+		if name == w.home && !clusterHealth.Ready {
+			health.Ready = false
+		}
 	}
+	return health
 }
@@ -1,12 +1,25 @@
 package config
 
 import (
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
+	// Mode is the component the process runs as: watcher, metrics or testserver
+	Mode string `mapstructure:"mode"`
+
+	// Reload makes the watcher pick up changes of the config file, such as
+	// an updated ConfigMap, every Interval. Zero disables reloading.
+	Reload struct {
+		Interval time.Duration `mapstructure:"interval"`
+	} `mapstructure:"reload"`
+
+	// file is the config file Load read, if any
+	file string
+
 	Server struct {
 		Port    int           `mapstructure:"port"`
 		Host    string        `mapstructure:"host"`
@@ -14,29 +27,297 @@ type Config struct {
 	}
 
 	Kubernetes struct {
-		PollInterval time.Duration `mapstructure:"poll_interval"`
-		ClusterName  string        `mapstructure:"cluster_name"`
+		Connection `mapstructure:",squash"`
+
+		PollInterval      time.Duration `mapstructure:"poll_interval"`
+		ClusterName       string        `mapstructure:"cluster_name"`
+		SnapshotChunkSize int           `mapstructure:"snapshot_chunk_size"`
+
+		// Resources lists the built-in resource types to watch, see
+		// types.ResourceTypes; all of them when empty
+		Resources []string `mapstructure:"resources"`
+		Dynamic   Dynamic  `mapstructure:"dynamic"`
+
+		// Scope limits the namespaces and objects watched in every cluster
+		Scope Scope `mapstructure:"scope"`
+
+		// Clusters are watched instead of the cluster the agent connects to
+		// through Connection, which then only holds the lease and the
+		// cluster secrets. Connection settings left empty are inherited.
+		Clusters []Cluster `mapstructure:"clusters"`
+
+		// ClusterSecrets adds a cluster for every Secret in Namespace that
+		// matches Selector, while it exists. The Secret holds a kubeconfig
+		// under the kubeconfig key; the cluster is named after the Secret
+		// unless it has a skyflo.ai/cluster-name annotation.
+		ClusterSecrets struct {
+			Namespace string `mapstructure:"namespace"`
+			Selector  string `mapstructure:"selector"`
+		} `mapstructure:"cluster_secrets"`
 	}
 
+	// Metrics configures the metrics collector, which polls every
+	// Kubernetes.PollInterval and keeps RetentionDays of samples in memory,
+	// at most MaxPoints per series. The cap bounds the memory of a node with
+	// many pods: at the default of 240, two hours at 30s, each pod takes
+	// some 50KiB.
+	// NodeName limits it to one node, as in the DaemonSet where it is set
+	// through the downward API; without it every node is collected.
+	Metrics struct {
+		RetentionDays int    `mapstructure:"retention_days"`
+		MaxPoints     int    `mapstructure:"max_points"`
+		NodeName      string `mapstructure:"node_name"`
+
+		// Kubelet reads the Summary API of the kubelet on NodeName for the
+		// disk, network, container and volume usage metrics-server lacks,
+		// and for the CPU and memory of its pods. It talks to the kubelet
+		// at Address, such as https://10.0.0.1:10250, or else at the
+		// address the node reports. Kubelet serving certificates are often
+		// self-signed, see InsecureSkipVerify. Proxy goes through the API
+		// server node proxy instead, which needs get on nodes/proxy.
+		Kubelet struct {
+			Enabled            bool   `mapstructure:"enabled"`
+			Address            string `mapstructure:"address"`
+			InsecureSkipVerify bool   `mapstructure:"insecure_skip_verify"`
+			Proxy              bool   `mapstructure:"proxy"`
+		} `mapstructure:"kubelet"`
+	} `mapstructure:"metrics"`
+
+	// LeaderElection lets several watcher replicas share a Lease. Standbys
+	// keep their informer caches warm but send nothing until they hold it.
+	// Identity defaults to the hostname, which is the pod name.
+	LeaderElection struct {
+		Enabled        bool          `mapstructure:"enabled"`
+		LeaseName      string        `mapstructure:"lease_name"`
+		LeaseNamespace string        `mapstructure:"lease_namespace"`
+		Identity       string        `mapstructure:"identity"`
+		LeaseDuration  time.Duration `mapstructure:"lease_duration"`
+		RenewDeadline  time.Duration `mapstructure:"renew_deadline"`
+		RetryPeriod    time.Duration `mapstructure:"retry_period"`
+	} `mapstructure:"leader_election"`
+
+	// Log configures structured logging. Level applies to every component
+	// not listed in Components (watcher, sender, metrics, client-go).
+	Log struct {
+		Level      string            `mapstructure:"level"`
+		Format     string            `mapstructure:"format"`
+		Components map[string]string `mapstructure:"components"`
+	} `mapstructure:"log"`
+
 	API struct {
 		Key    string `mapstructure:"key"`
 		Server string `mapstructure:"server"`
 	}
+
+	// Redaction rules are glob patterns. Secret values are always redacted.
+	Redaction struct {
+		Salt          string   `mapstructure:"salt"`
+		ConfigMapKeys []string `mapstructure:"configmap_keys"`
+		EnvVars       []string `mapstructure:"env_vars"`
+		Annotations   []string `mapstructure:"annotations"`
+	}
+
+	// Transform slims event payloads. Rules are keyed by resource type and
+	// hold JSON paths, see transform.ParsePath for the syntax.
+	Transform struct {
+		DropManagedFields bool                  `mapstructure:"drop_managed_fields"`
+		DropLastApplied   bool                  `mapstructure:"drop_last_applied"`
+		Rules             map[string]FieldRules `mapstructure:"rules"`
+
+		// Patch adds a patch from the previous version of the object to
+		// UPDATE events. Format is json-patch, merge-patch or empty for none;
+		// without IncludeObject the patch replaces the full object.
+		Patch struct {
+			Format        string `mapstructure:"format"`
+			IncludeObject bool   `mapstructure:"include_object"`
+		}
+	}
+
+	Sender struct {
+		Spool struct {
+			Dir          string        `mapstructure:"dir"`
+			MaxBytes     int64         `mapstructure:"max_bytes"`
+			MaxAge       time.Duration `mapstructure:"max_age"`
+			SegmentBytes int64         `mapstructure:"segment_bytes"`
+		} `mapstructure:"spool"`
+
+		Batch Batch `mapstructure:"batch"`
+
+		Retry struct {
+			InitialInterval time.Duration `mapstructure:"initial_interval"`
+			MaxInterval     time.Duration `mapstructure:"max_interval"`
+			Multiplier      float64       `mapstructure:"multiplier"`
+		} `mapstructure:"retry"`
+
+		Breaker struct {
+			FailureThreshold int           `mapstructure:"failure_threshold"`
+			OpenDuration     time.Duration `mapstructure:"open_duration"`
+		} `mapstructure:"breaker"`
+
+		// DrainTimeout bounds how long shutdown keeps delivering spooled
+		// events. Keep it below the pod's terminationGracePeriodSeconds.
+		DrainTimeout time.Duration `mapstructure:"drain_timeout"`
+	}
+}
+
+// Dynamic configures watching of arbitrary resources through the dynamic
+// client. Resources are group/version/resource strings (version/resource
+// for the core group); CRDGroups are glob patterns matched against the
+// group of every installed CRD.
+type Dynamic struct {
+	Resources         []string      `mapstructure:"resources"`
+	CRDGroups         []string      `mapstructure:"crd_groups"`
+	DiscoveryInterval time.Duration `mapstructure:"discovery_interval"`
 }
 
-func Load() (*Config, error) {
-	viper.SetDefault("server.port", 8080)
-	viper.SetDefault("server.host", "0.0.0.0")
-	viper.SetDefault("server.timeout", time.Second*30)
-	viper.SetDefault("kubernetes.poll_interval", time.Second*30)
+// Scope limits what is watched. Namespaces and ExcludeNamespaces hold exact
+// names or glob patterns; without Namespaces every namespace not excluded
+// is watched. When Namespaces only holds exact names the agent runs
+// namespace-scoped: each namespace gets its own informers, so a Role in each
+// of them is enough, and cluster-scoped resources such as nodes are not
+// watched. The selectors apply to every resource type that has no entry in
+// Resources, which is keyed by resource type.
+type Scope struct {
+	Namespaces        []string `mapstructure:"namespaces"`
+	ExcludeNamespaces []string `mapstructure:"exclude_namespaces"`
 
-	viper.AutomaticEnv()
-	viper.SetEnvPrefix("SKYFLO")
+	Selectors `mapstructure:",squash"`
+	Resources map[string]Selectors `mapstructure:"resources"`
+}
+
+// Selectors are label and field selectors in the syntax of kubectl's
+// --selector and --field-selector
+type Selectors struct {
+	LabelSelector string `mapstructure:"label_selector"`
+	FieldSelector string `mapstructure:"field_selector"`
+}
 
-	var config Config
-	if err := viper.Unmarshal(&config); err != nil {
-		return nil, err
+// Namespaced reports whether the scope only names exact namespaces, see Scope
+func (s Scope) Namespaced() bool {
+	if len(s.Namespaces) == 0 {
+		return false
 	}
+	for _, namespace := range s.Namespaces {
+		if strings.ContainsAny(namespace, "*?[") {
+			return false
+		}
+	}
+	return true
+}
+
+// SelectorsFor returns the selectors of resourceType
+func (s Scope) SelectorsFor(resourceType string) Selectors {
+	if selectors, ok := s.Resources[resourceType]; ok {
+		return selectors
+	}
+	return s.Selectors
+}
+
+// Cluster is a cluster watched by a multi-cluster agent
+type Cluster struct {
+	Name       string `mapstructure:"name"`
+	Connection `mapstructure:",squash"`
+}
+
+// Connection says how to reach a cluster. Without a kubeconfig or context
+// the in-cluster service account is used, and outside a cluster the default
+// kubeconfig loading rules ($KUBECONFIG, ~/.kube/config) apply.
+type Connection struct {
+	Kubeconfig string  `mapstructure:"kubeconfig"`
+	Context    string  `mapstructure:"context"`
+	QPS        float32 `mapstructure:"qps"`
+	Burst      int     `mapstructure:"burst"`
+
+	Impersonate struct {
+		User   string   `mapstructure:"user"`
+		UID    string   `mapstructure:"uid"`
+		Groups []string `mapstructure:"groups"`
+	} `mapstructure:"impersonate"`
+}
+
+// Batch configures delivery of several events per request. Linger is how
+// long a batch that is not full yet waits for more events.
+type Batch struct {
+	Enabled     bool          `mapstructure:"enabled"`
+	MaxEvents   int           `mapstructure:"max_events"`
+	MaxBytes    int           `mapstructure:"max_bytes"`
+	Linger      time.Duration `mapstructure:"linger"`
+	Compression string        `mapstructure:"compression"`
+}
+
+// FieldRules selects the fields kept in the payloads of a resource type.
+// With an allow list only those fields are kept; deny removes fields.
+// Changes confined to ignore paths do not produce an UPDATE event.
+type FieldRules struct {
+	Allow  []string `mapstructure:"allow"`
+	Deny   []string `mapstructure:"deny"`
+	Ignore []string `mapstructure:"ignore"`
+}
+
+// setDefaults registers the default of every setting. A key only picks
+// up its SKYFLO_ environment variable if it has a default or an explicit
+// binding, so settings without a natural default are set to their zero value.
+func setDefaults(v *viper.Viper) {
+	v.SetDefault("mode", "")
+	v.SetDefault("api.server", "")
+	v.SetDefault("api.key", "")
+	v.SetDefault("kubernetes.cluster_name", "")
+	v.SetDefault("kubernetes.kubeconfig", "")
+	v.SetDefault("kubernetes.context", "")
+	v.SetDefault("redaction.salt", "")
 
-	return &config, nil
+	v.SetDefault("reload.interval", time.Second*10)
+	v.SetDefault("server.port", 8080)
+	v.SetDefault("server.host", "0.0.0.0")
+	v.SetDefault("server.timeout", time.Second*30)
+	v.SetDefault("kubernetes.qps", 20)
+	v.SetDefault("kubernetes.burst", 40)
+	v.SetDefault("kubernetes.poll_interval", time.Second*30)
+	v.SetDefault("kubernetes.snapshot_chunk_size", 500)
+	v.SetDefault("kubernetes.resources", []string{})
+	v.SetDefault("kubernetes.dynamic.discovery_interval", time.Minute*5)
+	v.SetDefault("kubernetes.cluster_secrets.selector", "skyflo.ai/cluster=true")
+	v.SetDefault("metrics.retention_days", 1)
+	v.SetDefault("metrics.max_points", 240)
+	v.SetDefault("metrics.node_name", "")
+	v.SetDefault("metrics.kubelet.enabled", true)
+	v.SetDefault("metrics.kubelet.address", "")
+	v.SetDefault("metrics.kubelet.insecure_skip_verify", false)
+	v.SetDefault("metrics.kubelet.proxy", false)
+	v.SetDefault("log.level", "info")
+	v.SetDefault("log.format", "json")
+	v.SetDefault("leader_election.enabled", false)
+	v.SetDefault("leader_election.lease_name", "skyflo-k8s-watcher")
+	v.SetDefault("leader_election.lease_namespace", "default")
+	v.SetDefault("leader_election.lease_duration", time.Second*15)
+	v.SetDefault("leader_election.renew_deadline", time.Second*10)
+	v.SetDefault("leader_election.retry_period", time.Second*2)
+	v.SetDefault("redaction.configmap_keys", []string{"*password*", "*secret*", "*token*", "*credentials*"})
+	v.SetDefault("redaction.env_vars", []string{"*PASSWORD*", "*SECRET*", "*TOKEN*", "*API_KEY*", "*CREDENTIALS*"})
+	v.SetDefault("redaction.annotations", []string{"kubectl.kubernetes.io/last-applied-configuration"})
+	v.SetDefault("transform.drop_managed_fields", true)
+	v.SetDefault("transform.drop_last_applied", true)
+	v.SetDefault("transform.rules", map[string]interface{}{
+		"node": map[string]interface{}{
+			"deny":   []string{"status.images"},
+			"ignore": []string{"status.conditions[*].lastHeartbeatTime"},
+		},
+	})
+	v.SetDefault("transform.patch.format", "")
+	v.SetDefault("transform.patch.include_object", true)
+	v.SetDefault("sender.spool.dir", "/var/lib/skyflo/spool")
+	v.SetDefault("sender.spool.max_bytes", 256<<20)
+	v.SetDefault("sender.spool.max_age", time.Hour*24)
+	v.SetDefault("sender.spool.segment_bytes", 8<<20)
+	v.SetDefault("sender.batch.enabled", false)
+	v.SetDefault("sender.batch.max_events", 500)
+	v.SetDefault("sender.batch.max_bytes", 4<<20)
+	v.SetDefault("sender.batch.linger", time.Second)
+	v.SetDefault("sender.batch.compression", "gzip")
+	v.SetDefault("sender.retry.initial_interval", time.Second)
+	v.SetDefault("sender.retry.max_interval", time.Minute*2)
+	v.SetDefault("sender.retry.multiplier", 2.0)
+	v.SetDefault("sender.breaker.failure_threshold", 5)
+	v.SetDefault("sender.breaker.open_duration", time.Second*30)
+	v.SetDefault("sender.drain_timeout", time.Second*20)
 }
@@ -0,0 +1,149 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mitchellh/mapstructure"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// Modes a binary can run as
+const (
+	ModeWatcher    = "watcher"
+	ModeMetrics    = "metrics"
+	ModeTestServer = "testserver"
+)
+
+// DefaultFile is read when no config file is given, if it exists
+const DefaultFile = "/etc/skyflo/config.yaml"
+
+// envBindings are the environment variables the manifests use, which do not
+// follow the SKYFLO_<KEY> naming. Every other key can be set through
+// SKYFLO_ followed by its path in upper case with dots replaced by
+// underscores, e.g. SKYFLO_SENDER_BATCH_ENABLED.
+var envBindings = map[string][]string{
+	"api.server":              {"SKYFLO_MASTER_SERVER_URL", "SKYFLO_API_SERVER"},
+	"api.key":                 {"SKYFLO_API_KEY"},
+	"kubernetes.cluster_name": {"SKYFLO_CLUSTER_NAME", "SKYFLO_KUBERNETES_CLUSTER_NAME"},
+	"kubernetes.poll_interval": {
+		"SKYFLO_POLL_INTERVAL", "SKYFLO_KUBERNETES_POLL_INTERVAL",
+	},
+}
+
+// flagBindings maps command-line flags to the keys they set
+var flagBindings = map[string]string{
+	"mode":         "mode",
+	"api-server":   "api.server",
+	"cluster-name": "kubernetes.cluster_name",
+	"kubeconfig":   "kubernetes.kubeconfig",
+	"context":      "kubernetes.context",
+	"log-level":    "log.level",
+	"port":         "server.port",
+}
+
+// Load reads the configuration of a binary running as mode from, in order
+// of precedence:
+//
+//  1. command-line flags in args
+//  2. environment variables (see envBindings)
+//  3. the YAML file named by --config or SKYFLO_CONFIG, or DefaultFile
+//  4. built-in defaults
+//
+// and validates it. The mode defaults to the binary's own and may not name
+// another one.
+func Load(mode string, args []string) (*Config, error) {
+	v := viper.New()
+	setDefaults(v)
+	v.SetDefault("mode", mode)
+
+	flags := pflag.NewFlagSet(mode, pflag.ContinueOnError)
+	configFile := flags.String("config", "", "path to a YAML config file (env SKYFLO_CONFIG)")
+	flags.String("mode", mode, "component to run; must match the binary")
+	flags.String("api-server", "", "URL of the Skyflo server events are sent to")
+	flags.String("cluster-name", "", "name stamped on every event of the watched cluster")
+	flags.String("kubeconfig", "", "kubeconfig file, in-cluster config is used when empty")
+	flags.String("context", "", "kubeconfig context to use")
+	flags.String("log-level", "", "default log level: debug, info, warn or error")
+	flags.Int("port", 0, "port of the health and metrics server")
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
+
+	for name, key := range flagBindings {
+		if err := v.BindPFlag(key, flags.Lookup(name)); err != nil {
+			return nil, fmt.Errorf("failed to bind flag %s: %w", name, err)
+		}
+	}
+
+	v.SetEnvPrefix("SKYFLO")
+	v.SetEnvKeyReplacer(strings.NewReplacer(".", "_"))
+	v.AutomaticEnv()
+	for key, names := range envBindings {
+		if err := v.BindEnv(append([]string{key}, names...)...); err != nil {
+			return nil, fmt.Errorf("failed to bind environment for %s: %w", key, err)
+		}
+	}
+
+	path := *configFile
+	if path == "" {
+		path = os.Getenv("SKYFLO_CONFIG")
+	}
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+	if path != "" {
+		v.SetConfigFile(path)
+		v.SetConfigType("yaml")
+		if err := v.ReadInConfig(); err != nil {
+			return nil, fmt.Errorf("failed to read config file %s: %w", path, err)
+		}
+	}
+
+	var config Config
+	if err := v.Unmarshal(&config, viper.DecodeHook(mapstructure.ComposeDecodeHookFunc(
+		secondsToDurationHook,
+		mapstructure.StringToTimeDurationHookFunc(),
+		mapstructure.StringToSliceHookFunc(","),
+	))); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+
+	if config.Mode != mode {
+		return nil, fmt.Errorf("invalid config: mode %q does not match this binary, which runs as %q", config.Mode, mode)
+	}
+
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	config.file = path
+
+	return &config, nil
+}
+
+// secondsToDurationHook accepts a bare number of seconds for durations, as
+// SKYFLO_POLL_INTERVAL has always been given
+func secondsToDurationHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(time.Duration(0)) || from.Kind() != reflect.String {
+		return data, nil
+	}
+	seconds, err := strconv.Atoi(strings.TrimSpace(data.(string)))
+	if err != nil {
+		return data, nil
+	}
+	return time.Duration(seconds) * time.Second, nil
+}
+
+// IsHelp reports whether err from Load is the result of --help, which has
+// already printed the usage
+func IsHelp(err error) bool {
+	return errors.Is(err, pflag.ErrHelp)
+}
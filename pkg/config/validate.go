@@ -0,0 +1,131 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// Validate checks the settings the agent cannot run without, reporting
+// every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	positive := func(key string, d time.Duration) {
+		check(d > 0, "%s must be a positive duration, got %s", key, d)
+	}
+	nonNegative := func(key string, d time.Duration) {
+		check(d >= 0, "%s must not be negative, got %s", key, d)
+	}
+
+	switch c.Mode {
+	case ModeWatcher, ModeMetrics, ModeTestServer:
+	default:
+		errs = append(errs, fmt.Errorf("mode must be one of %s, %s or %s, got %q", ModeWatcher, ModeMetrics, ModeTestServer, c.Mode))
+	}
+
+	if c.Mode != ModeTestServer {
+		if c.API.Server == "" {
+			errs = append(errs, errors.New("api.server is required (SKYFLO_MASTER_SERVER_URL or --api-server)"))
+		} else if u, err := url.Parse(c.API.Server); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			errs = append(errs, fmt.Errorf("api.server must be an http or https URL, got %q", c.API.Server))
+		}
+	}
+
+	multiCluster := len(c.Kubernetes.Clusters) > 0 || c.Kubernetes.ClusterSecrets.Namespace != ""
+	if c.Mode == ModeMetrics || (c.Mode == ModeWatcher && !multiCluster) {
+		check(c.Kubernetes.ClusterName != "", "kubernetes.cluster_name is required (SKYFLO_CLUSTER_NAME or --cluster-name)")
+	}
+	for i, cluster := range c.Kubernetes.Clusters {
+		check(cluster.Name != "" || cluster.Context != "", "kubernetes.clusters[%d] needs a name or a context", i)
+	}
+
+	nonNegative("reload.interval", c.Reload.Interval)
+	for _, resource := range c.Kubernetes.Resources {
+		check(slices.Contains(types.ResourceTypes, types.ResourceType(resource)), "kubernetes.resources entry %q is not a built-in resource type, watch it through kubernetes.dynamic.resources", resource)
+	}
+	scope := c.Kubernetes.Scope
+	for _, pattern := range append(append([]string{}, scope.Namespaces...), scope.ExcludeNamespaces...) {
+		_, err := path.Match(pattern, "")
+		check(err == nil, "kubernetes.scope namespace pattern %q is invalid", pattern)
+	}
+	checkSelectors := func(key string, selectors Selectors) {
+		_, err := labels.Parse(selectors.LabelSelector)
+		check(err == nil, "%s.label_selector is invalid: %v", key, err)
+		_, err = fields.ParseSelector(selectors.FieldSelector)
+		check(err == nil, "%s.field_selector is invalid: %v", key, err)
+	}
+	checkSelectors("kubernetes.scope", scope.Selectors)
+	for resourceType, selectors := range scope.Resources {
+		checkSelectors("kubernetes.scope.resources."+resourceType, selectors)
+	}
+
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535, got %d", c.Server.Port)
+	positive("server.timeout", c.Server.Timeout)
+	positive("kubernetes.poll_interval", c.Kubernetes.PollInterval)
+	positive("kubernetes.dynamic.discovery_interval", c.Kubernetes.Dynamic.DiscoveryInterval)
+	check(c.Kubernetes.SnapshotChunkSize > 0, "kubernetes.snapshot_chunk_size must be positive, got %d", c.Kubernetes.SnapshotChunkSize)
+	check(c.Metrics.RetentionDays > 0, "metrics.retention_days must be positive, got %d", c.Metrics.RetentionDays)
+	check(c.Metrics.MaxPoints > 0, "metrics.max_points must be positive, got %d", c.Metrics.MaxPoints)
+	if address := c.Metrics.Kubelet.Address; address != "" {
+		u, err := url.Parse(address)
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "", "metrics.kubelet.address must be an http(s) URL, got %q", address)
+		check(!c.Metrics.Kubelet.Proxy, "metrics.kubelet.address and metrics.kubelet.proxy are mutually exclusive")
+	}
+
+	if c.LeaderElection.Enabled {
+		le := c.LeaderElection
+		check(le.LeaseName != "" && le.LeaseNamespace != "", "leader_election.lease_name and lease_namespace are required")
+		positive("leader_election.retry_period", le.RetryPeriod)
+		check(le.LeaseDuration > le.RenewDeadline && le.RenewDeadline > le.RetryPeriod,
+			"leader_election durations must satisfy lease_duration > renew_deadline > retry_period, got %s, %s, %s",
+			le.LeaseDuration, le.RenewDeadline, le.RetryPeriod)
+	}
+
+	var level slog.Level
+	check(level.UnmarshalText([]byte(c.Log.Level)) == nil, "log.level must be debug, info, warn or error, got %q", c.Log.Level)
+	for component, value := range c.Log.Components {
+		check(level.UnmarshalText([]byte(value)) == nil, "log.components.%s must be debug, info, warn or error, got %q", component, value)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text, got %q", c.Log.Format)
+
+	switch c.Transform.Patch.Format {
+	case "", "json-patch", "merge-patch":
+	default:
+		errs = append(errs, fmt.Errorf("transform.patch.format must be json-patch, merge-patch or empty, got %q", c.Transform.Patch.Format))
+	}
+
+	check(c.Sender.Spool.Dir != "", "sender.spool.dir is required")
+	check(c.Sender.Spool.SegmentBytes > 0, "sender.spool.segment_bytes must be positive, got %d", c.Sender.Spool.SegmentBytes)
+	nonNegative("sender.spool.max_age", c.Sender.Spool.MaxAge)
+	if c.Sender.Batch.Enabled {
+		check(c.Sender.Batch.MaxEvents > 0, "sender.batch.max_events must be positive, got %d", c.Sender.Batch.MaxEvents)
+		nonNegative("sender.batch.linger", c.Sender.Batch.Linger)
+	}
+	switch c.Sender.Batch.Compression {
+	case "", "none", "gzip", "zstd":
+	default:
+		errs = append(errs, fmt.Errorf("sender.batch.compression must be none, gzip or zstd, got %q", c.Sender.Batch.Compression))
+	}
+	positive("sender.retry.initial_interval", c.Sender.Retry.InitialInterval)
+	check(c.Sender.Retry.MaxInterval >= c.Sender.Retry.InitialInterval,
+		"sender.retry.max_interval must be at least initial_interval, got %s", c.Sender.Retry.MaxInterval)
+	check(c.Sender.Retry.Multiplier >= 1, "sender.retry.multiplier must be at least 1, got %g", c.Sender.Retry.Multiplier)
+	positive("sender.breaker.open_duration", c.Sender.Breaker.OpenDuration)
+	nonNegative("sender.drain_timeout", c.Sender.DrainTimeout)
+
+	return errors.Join(errs...)
+}
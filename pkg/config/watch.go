@@ -0,0 +1,64 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
+)
+
+// Watch polls the config file current was loaded from and, whenever its
+// contents change, loads it again with the same args and hands the result
+// to apply. ConfigMap volumes are updated by swapping a symlink, which is
+// why the contents are compared instead of watching for writes. A config
+// that fails to load or validate, or that apply rejects, is logged and
+// counted, and the previous one stays in effect. Watch returns when ctx is
+// cancelled, or right away without a config file or reload interval.
+func Watch(ctx context.Context, current *Config, args []string, log *slog.Logger, apply func(*Config) error) {
+	if current.file == "" || current.Reload.Interval <= 0 {
+		return
+	}
+
+	seen, err := os.ReadFile(current.file)
+	if err != nil {
+		log.Warn("failed to read config file", "file", current.file, "error", err)
+	}
+
+	ticker := time.NewTicker(current.Reload.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+
+		contents, err := os.ReadFile(current.file)
+		if err != nil {
+			// The file briefly disappears while a ConfigMap is updated
+			continue
+		}
+		if bytes.Equal(contents, seen) {
+			continue
+		}
+		seen = contents
+
+		cfg, err := Load(current.Mode, args)
+		if err == nil {
+			err = apply(cfg)
+		}
+		if err != nil {
+			log.Error("rejected config change, keeping the previous config", "file", current.file, "error", err)
+			telemetry.ConfigReloads.WithLabelValues("rejected").Inc()
+			continue
+		}
+
+		log.Info("reloaded config", "file", current.file)
+		telemetry.ConfigReloads.WithLabelValues("applied").Inc()
+		telemetry.ConfigLastReload.SetToCurrentTime()
+	}
+}
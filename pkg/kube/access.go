@@ -0,0 +1,72 @@
+package kube
+
+import (
+	"context"
+	"fmt"
+
+	authorizationv1 "k8s.io/api/authorization/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/kubernetes"
+)
+
+// Access is the access needed to a resource, in Namespace or cluster-wide
+// when it is empty
+type Access struct {
+	Resource  schema.GroupVersionResource
+	Namespace string
+	Verbs     []string
+}
+
+func (a Access) String() string {
+	resource := a.Resource.GroupResource().String()
+	if a.Namespace != "" {
+		return fmt.Sprintf("%v %s in %s", a.Verbs, resource, a.Namespace)
+	}
+	return fmt.Sprintf("%v %s", a.Verbs, resource)
+}
+
+// Denied asks the API server, through SelfSubjectAccessReviews, which of
+// the verbs of access the client is not allowed to use
+func Denied(ctx context.Context, client kubernetes.Interface, access Access) ([]string, error) {
+	var denied []string
+	for _, verb := range access.Verbs {
+		review, err := client.AuthorizationV1().SelfSubjectAccessReviews().Create(ctx, &authorizationv1.SelfSubjectAccessReview{
+			Spec: authorizationv1.SelfSubjectAccessReviewSpec{
+				ResourceAttributes: &authorizationv1.ResourceAttributes{
+					Namespace: access.Namespace,
+					Verb:      verb,
+					Group:     access.Resource.Group,
+					Resource:  access.Resource.Resource,
+				},
+			},
+		}, metav1.CreateOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("failed to review access to %s: %w", access.Resource.GroupResource(), err)
+		}
+		if !review.Status.Allowed {
+			denied = append(denied, verb)
+		}
+	}
+	return denied, nil
+}
+
+// Served reports whether discovery lists the resource in its group version
+func Served(client discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (bool, error) {
+	resources, err := client.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if apierrors.IsNotFound(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to discover %s: %w", gvr.GroupVersion(), err)
+	}
+
+	for _, resource := range resources.APIResources {
+		if resource.Name == gvr.Resource {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,61 @@
+package kube
+
+import (
+	"errors"
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// RESTConfig builds the client configuration for conn. An explicit
+// kubeconfig or context wins; otherwise the in-cluster service account is
+// used, falling back to the default kubeconfig when not running in a pod.
+func RESTConfig(conn config.Connection) (*rest.Config, error) {
+	var restConfig *rest.Config
+	var err error
+
+	if conn.Kubeconfig == "" && conn.Context == "" {
+		restConfig, err = rest.InClusterConfig()
+		if errors.Is(err, rest.ErrNotInCluster) {
+			restConfig, err = kubeconfig(conn)
+		}
+	} else {
+		restConfig, err = kubeconfig(conn)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.QPS > 0 {
+		restConfig.QPS = conn.QPS
+	}
+	if conn.Burst > 0 {
+		restConfig.Burst = conn.Burst
+	}
+	if conn.Impersonate.User != "" {
+		restConfig.Impersonate = rest.ImpersonationConfig{
+			UserName: conn.Impersonate.User,
+			UID:      conn.Impersonate.UID,
+			Groups:   conn.Impersonate.Groups,
+		}
+	}
+
+	return restConfig, nil
+}
+
+func kubeconfig(conn config.Connection) (*rest.Config, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	if conn.Kubeconfig != "" {
+		rules.ExplicitPath = conn.Kubeconfig
+	}
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: conn.Context}
+
+	restConfig, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("failed to load kubeconfig: %w", err)
+	}
+	return restConfig, nil
+}
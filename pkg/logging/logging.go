@@ -0,0 +1,148 @@
+// Package logging sets up the structured logs of the agent. Every component
+// (watcher, sender, metrics, client-go) gets its own logger with its own
+// level, all writing to the same sink.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"k8s.io/klog/v2"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// Components with a configurable level
+const (
+	ComponentWatcher  = "watcher"
+	ComponentSender   = "sender"
+	ComponentMetrics  = "metrics"
+	ComponentServer   = "server"
+	ComponentClientGo = "client-go"
+)
+
+var (
+	mu           sync.Mutex
+	sink         slog.Handler = newSink(os.Stdout, "json")
+	defaultLevel              = new(slog.LevelVar)
+	levels                    = make(map[string]*slog.LevelVar)
+)
+
+// Setup configures the sink and the levels from cfg and routes klog, and
+// with it client-go, into the client-go logger. Loggers returned by For
+// before Setup keep writing to the previous sink.
+func Setup(cfg *config.Config) error {
+	switch cfg.Log.Format {
+	case "json", "text":
+	default:
+		return fmt.Errorf("unsupported log format %q", cfg.Log.Format)
+	}
+
+	if err := SetLevels(cfg); err != nil {
+		return err
+	}
+
+	mu.Lock()
+	sink = newSink(os.Stdout, cfg.Log.Format)
+	mu.Unlock()
+
+	klog.SetSlogLogger(For(ComponentClientGo))
+	slog.SetDefault(For(ComponentWatcher))
+	return nil
+}
+
+// SetLevels applies the levels in cfg to every logger, including the ones
+// already handed out
+func SetLevels(cfg *config.Config) error {
+	level, err := parseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+
+	componentLevels := make(map[string]slog.Level, len(cfg.Log.Components))
+	for component, value := range cfg.Log.Components {
+		if componentLevels[component], err = parseLevel(value); err != nil {
+			return fmt.Errorf("invalid level for %s: %w", component, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	defaultLevel.Set(level)
+	for component, levelVar := range levels {
+		if l, ok := componentLevels[component]; ok {
+			levelVar.Set(l)
+		} else {
+			levelVar.Set(level)
+		}
+	}
+	for component, l := range componentLevels {
+		if _, ok := levels[component]; !ok {
+			levels[component] = new(slog.LevelVar)
+			levels[component].Set(l)
+		}
+	}
+	return nil
+}
+
+// For returns the logger of component
+func For(component string) *slog.Logger {
+	mu.Lock()
+	defer mu.Unlock()
+
+	level, ok := levels[component]
+	if !ok {
+		level = new(slog.LevelVar)
+		level.Set(defaultLevel.Level())
+		levels[component] = level
+	}
+
+	return slog.New(&leveledHandler{Handler: sink, level: level}).With("component", component)
+}
+
+func newSink(w io.Writer, format string) slog.Handler {
+	// Filtering happens per component in leveledHandler
+	options := &slog.HandlerOptions{Level: slog.LevelDebug}
+	if format == "text" {
+		return slog.NewTextHandler(w, options)
+	}
+	return slog.NewJSONHandler(w, options)
+}
+
+func parseLevel(value string) (slog.Level, error) {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(value))); err != nil {
+		return 0, fmt.Errorf("invalid log level %q", value)
+	}
+	return level, nil
+}
+
+// leveledHandler drops records below the level of its component
+type leveledHandler struct {
+	slog.Handler
+	level slog.Leveler
+}
+
+func (h *leveledHandler) Enabled(ctx context.Context, level slog.Level) bool {
+	return level >= h.level.Level() && h.Handler.Enabled(ctx, level)
+}
+
+func (h *leveledHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithAttrs(attrs), level: h.level}
+}
+
+func (h *leveledHandler) WithGroup(name string) slog.Handler {
+	return &leveledHandler{Handler: h.Handler.WithGroup(name), level: h.level}
+}
+
+// Fatal logs err at error level and exits
+func Fatal(log *slog.Logger, msg string, err error) {
+	log.Error(msg, "error", err)
+	os.Exit(1)
+}
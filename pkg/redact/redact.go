@@ -0,0 +1,176 @@
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+// Redactor strips sensitive values from objects before they leave the
+// cluster. A redacted value is replaced by its size and a salted hash so
+// the backend can still tell when it changes.
+type Redactor struct {
+	salt          []byte
+	configMapKeys []string
+	envVars       []string
+	annotations   []string
+}
+
+// New creates a Redactor from the redaction rules in cfg. Without a
+// configured salt a random one is used, so hashes are only comparable
+// within the lifetime of the process.
+func New(cfg *config.Config) (*Redactor, error) {
+	salt := []byte(cfg.Redaction.Salt)
+	if len(salt) == 0 {
+		salt = make([]byte, 32)
+		if _, err := rand.Read(salt); err != nil {
+			return nil, fmt.Errorf("failed to generate redaction salt: %w", err)
+		}
+	}
+
+	for _, patterns := range [][]string{cfg.Redaction.ConfigMapKeys, cfg.Redaction.EnvVars, cfg.Redaction.Annotations} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid redaction pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	return &Redactor{
+		salt:          salt,
+		configMapKeys: cfg.Redaction.ConfigMapKeys,
+		envVars:       cfg.Redaction.EnvVars,
+		annotations:   cfg.Redaction.Annotations,
+	}, nil
+}
+
+// lastAppliedAnnotation is set by kubectl apply to the whole object as it
+// was applied, data included
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// Redact removes sensitive values from obj in place. obj must be the
+// unstructured form of an object, with its apiVersion and kind, and must
+// not be shared with a cache. Secrets and ConfigMaps are recognized by
+// their kind, however they are watched.
+func (r *Redactor) Redact(obj map[string]interface{}) {
+	apiVersion, _ := obj["apiVersion"].(string)
+	kind, _ := obj["kind"].(string)
+	metadata, _ := obj["metadata"].(map[string]interface{})
+
+	if apiVersion == "v1" {
+		switch kind {
+		case "Secret":
+			// Secret values never leave the cluster, whatever the rules say
+			r.redactMap(obj, "data", true, func(string) bool { return true })
+			delete(obj, "stringData")
+			deleteAnnotation(metadata, lastAppliedAnnotation)
+		case "ConfigMap":
+			r.redactMap(obj, "data", false, r.matcher(r.configMapKeys))
+			r.redactMap(obj, "binaryData", true, r.matcher(r.configMapKeys))
+			// The annotation would carry the redacted keys in plaintext
+			deleteAnnotation(metadata, lastAppliedAnnotation)
+		}
+	}
+
+	if metadata != nil {
+		r.redactMap(metadata, "annotations", false, r.matcher(r.annotations))
+	}
+
+	if len(r.envVars) > 0 {
+		r.redactEnv(obj)
+	}
+}
+
+func deleteAnnotation(metadata map[string]interface{}, name string) {
+	if annotations, ok := metadata["annotations"].(map[string]interface{}); ok {
+		delete(annotations, name)
+	}
+}
+
+// redactMap replaces the values of obj[field] whose keys match. Base64
+// values are sized by their decoded length.
+func (r *Redactor) redactMap(obj map[string]interface{}, field string, base64Encoded bool, match func(string) bool) {
+	values, ok := obj[field].(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for key, value := range values {
+		if !match(key) {
+			continue
+		}
+		s, _ := value.(string)
+		raw := []byte(s)
+		if base64Encoded {
+			if decoded, err := base64.StdEncoding.DecodeString(s); err == nil {
+				raw = decoded
+			}
+		}
+		values[key] = r.placeholder(raw)
+	}
+}
+
+// redactEnv walks obj for container env lists, wherever they are nested
+// (pods, workload templates, custom resources), and replaces the values of
+// variables whose names match the env rules
+func (r *Redactor) redactEnv(obj interface{}) {
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		for key, child := range v {
+			if env, ok := child.([]interface{}); ok && key == "env" {
+				r.redactEnvList(env)
+				continue
+			}
+			r.redactEnv(child)
+		}
+	case []interface{}:
+		for _, child := range v {
+			r.redactEnv(child)
+		}
+	}
+}
+
+func (r *Redactor) redactEnvList(env []interface{}) {
+	for _, item := range env {
+		variable, ok := item.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		name, _ := variable["name"].(string)
+		value, ok := variable["value"].(string)
+		if ok && matches(r.envVars, name) {
+			variable["value"] = r.placeholder([]byte(value))
+		}
+	}
+}
+
+// placeholder is what a redacted value is replaced with
+func (r *Redactor) placeholder(value []byte) string {
+	mac := hmac.New(sha256.New, r.salt)
+	mac.Write(value)
+	return fmt.Sprintf("redacted:size=%d:hmac-sha256=%s", len(value), hex.EncodeToString(mac.Sum(nil)))
+}
+
+func (r *Redactor) matcher(patterns []string) func(string) bool {
+	return func(name string) bool {
+		return matches(patterns, name)
+	}
+}
+
+// matches reports whether name matches one of the glob patterns, ignoring case
+func matches(patterns []string, name string) bool {
+	name = strings.ToLower(name)
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(strings.ToLower(pattern), name); ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,144 @@
+package redact
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+)
+
+func newTestRedactor(t *testing.T, configure func(*config.Config)) *Redactor {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.Redaction.Salt = "salt"
+	cfg.Redaction.ConfigMapKeys = []string{"*password*"}
+	cfg.Redaction.EnvVars = []string{"*TOKEN*"}
+	if configure != nil {
+		configure(cfg)
+	}
+
+	r, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+// object decodes a JSON object, so every test gets a fresh copy
+func object(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &obj); err != nil {
+		t.Fatal(err)
+	}
+	return obj
+}
+
+func TestRedact(t *testing.T) {
+	const lastApplied = `"kubectl.kubernetes.io/last-applied-configuration": "{\"data\":{\"key\":\"plain\"}}"`
+
+	tests := []struct {
+		name      string
+		configure func(*config.Config)
+		obj       string
+		// leaked must not appear anywhere in the redacted object
+		leaked []string
+		// kept must still appear
+		kept []string
+	}{
+		{
+			name:   "secret data and stringData",
+			obj:    `{"apiVersion": "v1", "kind": "Secret", "data": {"key": "c2VjcmV0dmFsdWU="}, "stringData": {"other": "plainvalue"}}`,
+			leaked: []string{"c2VjcmV0dmFsdWU=", "plainvalue", "stringData"},
+			kept:   []string{"redacted:size=11:"},
+		},
+		{
+			name:      "secret last-applied without annotation rules",
+			configure: func(cfg *config.Config) { cfg.Redaction.Annotations = nil },
+			obj:       `{"apiVersion": "v1", "kind": "Secret", "metadata": {"annotations": {` + lastApplied + `, "team": "a"}}, "data": {"key": "cGxhaW4="}}`,
+			leaked:    []string{"last-applied-configuration", "plain"},
+			kept:      []string{`"team":"a"`},
+		},
+		{
+			name:   "secret watched through the dynamic client",
+			obj:    `{"apiVersion": "v1", "kind": "Secret", "metadata": {"name": "s"}, "type": "Opaque", "data": {"password": "aHVudGVyMg=="}}`,
+			leaked: []string{"aHVudGVyMg=="},
+		},
+		{
+			name:   "configmap keys matching the rules",
+			obj:    `{"apiVersion": "v1", "kind": "ConfigMap", "data": {"db_password": "hunter2", "mode": "fast"}, "binaryData": {"password.bin": "aHVudGVyMg=="}}`,
+			leaked: []string{"hunter2", "aHVudGVyMg=="},
+			kept:   []string{`"mode":"fast"`},
+		},
+		{
+			name:      "configmap last-applied without annotation rules",
+			configure: func(cfg *config.Config) { cfg.Redaction.Annotations = nil },
+			obj:       `{"apiVersion": "v1", "kind": "ConfigMap", "metadata": {"annotations": {` + lastApplied + `}}, "data": {"password": "plain"}}`,
+			leaked:    []string{"last-applied-configuration", "plain"},
+		},
+		{
+			name:   "custom resource named like a secret",
+			obj:    `{"apiVersion": "example.com/v1", "kind": "Secret", "data": {"key": "visible"}}`,
+			kept:   []string{`"key":"visible"`},
+			leaked: nil,
+		},
+		{
+			name: "annotations matching the rules",
+			configure: func(cfg *config.Config) {
+				cfg.Redaction.Annotations = []string{"example.com/token"}
+			},
+			obj:    `{"apiVersion": "v1", "kind": "Service", "metadata": {"annotations": {"example.com/token": "abc123", "team": "a"}}}`,
+			leaked: []string{"abc123"},
+			kept:   []string{`"team":"a"`},
+		},
+		{
+			name:   "env vars in a workload template",
+			obj:    `{"apiVersion": "apps/v1", "kind": "Deployment", "spec": {"template": {"spec": {"containers": [{"env": [{"name": "API_TOKEN", "value": "tok3n"}, {"name": "MODE", "value": "fast"}]}]}}}}`,
+			leaked: []string{"tok3n"},
+			kept:   []string{`"value":"fast"`},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newTestRedactor(t, test.configure)
+			obj := object(t, test.obj)
+			r.Redact(obj)
+
+			out, err := json.Marshal(obj)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range test.leaked {
+				if strings.Contains(string(out), s) {
+					t.Errorf("redacted object contains %q: %s", s, out)
+				}
+			}
+			for _, s := range test.kept {
+				if !strings.Contains(string(out), s) {
+					t.Errorf("redacted object lacks %q: %s", s, out)
+				}
+			}
+		})
+	}
+}
+
+func TestPlaceholderTracksChanges(t *testing.T) {
+	r := newTestRedactor(t, nil)
+
+	redact := func(value string) string {
+		obj := object(t, `{"apiVersion": "v1", "kind": "Secret", "data": {"key": "`+value+`"}}`)
+		r.Redact(obj)
+		return obj["data"].(map[string]interface{})["key"].(string)
+	}
+
+	if redact("YQ==") != redact("YQ==") {
+		t.Error("the same value redacted differently")
+	}
+	if redact("YQ==") == redact("Yg==") {
+		t.Error("different values redacted the same")
+	}
+}
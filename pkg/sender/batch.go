@@ -0,0 +1,204 @@
+package sender
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
+)
+
+// batchRequest is the body sent to the batch endpoint
+type batchRequest struct {
+	Events []json.RawMessage `json:"events"`
+}
+
+// batchResponse carries one result per event, in request order
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+type batchResult struct {
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// nextBatch blocks until there is something to deliver. With batching
+// enabled it waits up to the linger time for the batch to fill up to the
+// configured event count or byte size. While draining it never waits and
+// returns no records once the spool is empty.
+func (s *Sender) nextBatch(ctx context.Context, draining bool) ([]spoolRecord, error) {
+	batchCfg := s.batch.Load()
+	maxEvents, maxBytes, linger := 1, 0, time.Duration(0)
+	if batchCfg.Enabled {
+		maxEvents, maxBytes, linger = batchCfg.MaxEvents, batchCfg.MaxBytes, batchCfg.Linger
+		if s.batchLimit > 0 && s.batchLimit < maxEvents {
+			maxEvents = s.batchLimit
+		}
+	}
+
+	var timer *time.Timer
+	expired := false
+	defer func() {
+		if timer != nil {
+			timer.Stop()
+		}
+	}()
+
+	for {
+		records, err := s.spool.Peek(maxEvents)
+		if err != nil {
+			return nil, err
+		}
+
+		records, full := trimBatch(records, maxEvents, maxBytes)
+		if draining {
+			return records, nil
+		}
+		if len(records) > 0 {
+			if full || expired || linger <= 0 {
+				return records, nil
+			}
+			if timer == nil {
+				timer = time.NewTimer(linger)
+			}
+		}
+
+		var deadline <-chan time.Time
+		if timer != nil {
+			deadline = timer.C
+		}
+
+		select {
+		case <-s.spool.Notify():
+		case <-deadline:
+			expired = true
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// trimBatch cuts records down to maxBytes of encoded events and reports
+// whether the batch cannot grow any further. The first record is always
+// kept so an oversized event does not stall the spool.
+func trimBatch(records []spoolRecord, maxEvents, maxBytes int) ([]spoolRecord, bool) {
+	if maxBytes <= 0 {
+		return records, len(records) >= maxEvents
+	}
+
+	size := 0
+	for i, record := range records {
+		size += len(record.data) + 1
+		if i > 0 && size > maxBytes {
+			return records[:i], true
+		}
+	}
+	return records, len(records) >= maxEvents || size >= maxBytes
+}
+
+// sendBatch ships records as a single compressed request to the batch
+// endpoint. It returns how many records, counted from the start, were
+// accepted or permanently rejected; delivery resumes at the first event
+// the server asked to be retried.
+func (s *Sender) sendBatch(ctx context.Context, records []spoolRecord) (int, error) {
+	request := batchRequest{Events: make([]json.RawMessage, 0, len(records))}
+	for _, record := range records {
+		if !json.Valid(record.data) {
+			// Dropping corrupt records here keeps the indexes in the
+			// response aligned with what was actually sent
+			s.log.Warn("dropping corrupt spool record", "bytes", len(record.data))
+			telemetry.EventsDropped.WithLabelValues("corrupt").Inc()
+			continue
+		}
+		request.Events = append(request.Events, record.data)
+	}
+	if len(request.Events) == 0 {
+		return len(records), nil
+	}
+
+	payload, err := json.Marshal(request)
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal batch: %w", err)
+	}
+
+	body, encoding, err := s.compress(payload)
+	if err != nil {
+		return 0, fmt.Errorf("failed to compress batch: %w", err)
+	}
+
+	resp, err := s.post(ctx, "/api/v1/resources/batch", body, encoding)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	var result batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil || len(result.Results) != len(request.Events) {
+		// The server accepted the batch as a whole
+		telemetry.EventsSent.Add(float64(len(request.Events)))
+		return len(records), nil
+	}
+
+	sent := 0
+	for i, record := range records {
+		if !json.Valid(record.data) {
+			continue
+		}
+		r := result.Results[sent]
+		sent++
+
+		if r.Status < 300 {
+			telemetry.EventsSent.Inc()
+			continue
+		}
+		if !rejectedStatus(r.Status) {
+			return i, &StatusError{Code: r.Status}
+		}
+		s.log.Warn("server rejected event of batch, dropping it", "index", i, "status", r.Status, "error", r.Error)
+		telemetry.EventsDropped.WithLabelValues("rejected").Inc()
+	}
+
+	return len(records), nil
+}
+
+// compress encodes payload with the configured algorithm and returns the
+// matching Content-Encoding. The zstd encoder is created on first use, only
+// ever from the goroutine delivering events.
+func (s *Sender) compress(payload []byte) ([]byte, string, error) {
+	compression := s.batch.Load().Compression
+	switch compression {
+	case "", "none":
+		return payload, "", nil
+	case "gzip":
+		var buf bytes.Buffer
+		gz := gzip.NewWriter(&buf)
+		if _, err := gz.Write(payload); err != nil {
+			return nil, "", err
+		}
+		if err := gz.Close(); err != nil {
+			return nil, "", err
+		}
+		return buf.Bytes(), "gzip", nil
+	case "zstd":
+		if s.zstd == nil {
+			encoder, err := newZstdEncoder()
+			if err != nil {
+				return nil, "", err
+			}
+			s.zstd = encoder
+		}
+		return s.zstd.EncodeAll(payload, nil), "zstd", nil
+	default:
+		return nil, "", fmt.Errorf("unsupported compression %q", compression)
+	}
+}
+
+func newZstdEncoder() (*zstd.Encoder, error) {
+	return zstd.NewWriter(nil, zstd.WithEncoderConcurrency(1))
+}
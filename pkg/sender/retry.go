@@ -0,0 +1,221 @@
+package sender
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned instead of contacting the parent server while
+// the circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// StatusError is returned when the parent server answers with an error status
+type StatusError struct {
+	Code       int
+	RetryAfter time.Duration
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("server returned error status: %d", e.Code)
+}
+
+func newStatusError(resp *http.Response) *StatusError {
+	return &StatusError{
+		Code:       resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After")),
+	}
+}
+
+// parseRetryAfter understands both forms of the Retry-After header
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		if d := time.Until(at); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// rejectedStatus reports whether code means the server refused the events
+// themselves, so sending them again unchanged can never succeed. Any other
+// error status, a 500 during a backend deploy included, may be transient.
+func rejectedStatus(code int) bool {
+	switch code {
+	case http.StatusBadRequest,
+		http.StatusRequestEntityTooLarge,
+		http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+// authStatus reports whether code means the server did not accept the API
+// key. Nothing is wrong with the events, so they are kept until the key is
+// fixed, see breaker.
+func authStatus(code int) bool {
+	return code == http.StatusUnauthorized || code == http.StatusForbidden
+}
+
+// isRetryable classifies a delivery error. Only an error status the
+// server answered with can make events undeliverable, and only if
+// rejectedStatus says so. Everything else, other error statuses,
+// connection failures, timeouts, an open breaker or a cancelled request,
+// leaves the events to be sent again.
+func isRetryable(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		return !rejectedStatus(statusErr.Code)
+	}
+	return true
+}
+
+// backoff computes exponential delays with full jitter
+type backoff struct {
+	initial    time.Duration
+	max        time.Duration
+	multiplier float64
+	attempt    int
+}
+
+// next returns how long to wait before the next attempt. A Retry-After
+// sent by the server takes precedence when it asks for a longer pause.
+func (b *backoff) next(err error) time.Duration {
+	ceiling := float64(b.initial) * math.Pow(b.multiplier, float64(b.attempt))
+	if ceiling > float64(b.max) || math.IsInf(ceiling, 0) {
+		ceiling = float64(b.max)
+	} else {
+		b.attempt++
+	}
+	delay := time.Duration(rand.Int63n(int64(ceiling)) + 1)
+
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.RetryAfter > delay {
+		delay = statusErr.RetryAfter
+	}
+	return delay
+}
+
+func (b *backoff) reset() {
+	b.attempt = 0
+}
+
+// BreakerState is the state of the sender's circuit breaker
+type BreakerState string
+
+const (
+	BreakerClosed   BreakerState = "closed"
+	BreakerOpen     BreakerState = "open"
+	BreakerHalfOpen BreakerState = "half-open"
+)
+
+// breaker stops requests to the parent server after a run of consecutive
+// failures. Once openDuration has passed a single probe request is let
+// through; its outcome closes or re-opens the breaker.
+type breaker struct {
+	threshold    int
+	openDuration time.Duration
+
+	mu         sync.Mutex
+	state      BreakerState
+	failures   int
+	openedAt   time.Time
+	probing    bool
+	authFailed bool
+}
+
+func newBreaker(threshold int, openDuration time.Duration) *breaker {
+	return &breaker{
+		threshold:    threshold,
+		openDuration: openDuration,
+		state:        BreakerClosed,
+	}
+}
+
+// allow reports whether a request may be sent now
+func (b *breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if time.Since(b.openedAt) < b.openDuration {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.probing = true
+		return true
+	case BreakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	}
+	return true
+}
+
+// record feeds the outcome of a request into the breaker. Only transient
+// failures count, a rejected event says nothing about backend health. A
+// rejected API key opens the breaker at once: every request would fail the
+// same way, so only a probe per openDuration checks whether it was fixed.
+func (b *breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	var statusErr *StatusError
+	b.authFailed = errors.As(err, &statusErr) && authStatus(statusErr.Code)
+	if b.authFailed {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+		return
+	}
+
+	if err == nil || !isRetryable(err) {
+		b.state = BreakerClosed
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || (b.threshold > 0 && b.failures >= b.threshold) {
+		b.state = BreakerOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// State returns the current breaker state
+func (b *breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == BreakerOpen && time.Since(b.openedAt) >= b.openDuration {
+		return BreakerHalfOpen
+	}
+	return b.state
+}
+
+// AuthFailed reports whether the last response of the server rejected the
+// API key
+func (b *breaker) AuthFailed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.authFailed
+}
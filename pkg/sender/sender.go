@@ -4,10 +4,18 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
 
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/logging"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
 	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
 )
 
@@ -40,48 +48,302 @@ const (
 type Sender struct {
 	cfg        *config.Config
 	httpClient *http.Client
+	spool      *Spool
+	zstd       *zstd.Encoder
+	breaker    *breaker
+	backoff    backoff
+
+	// batch holds the batching settings, which can change at runtime
+	batch atomic.Pointer[config.Batch]
+
+	// batchLimit caps the batch size below the configured maximum after
+	// the server rejected a batch as too large
+	batchLimit int
+
+	// lastSend is when events were last delivered, in Unix nanoseconds
+	lastSend atomic.Int64
+
+	log *slog.Logger
 }
 
 // New creates a new Sender instance
-func New(cfg *config.Config) *Sender {
-	return &Sender{
+func New(cfg *config.Config) (*Sender, error) {
+	spool, err := OpenSpool(SpoolOptions{
+		Dir:          cfg.Sender.Spool.Dir,
+		MaxBytes:     cfg.Sender.Spool.MaxBytes,
+		MaxAge:       cfg.Sender.Spool.MaxAge,
+		SegmentBytes: cfg.Sender.Spool.SegmentBytes,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool: %w", err)
+	}
+
+	telemetry.SpoolDepth.Set(float64(spool.Depth()))
+
+	s := &Sender{
 		cfg: cfg,
 		httpClient: &http.Client{
 			Timeout: cfg.Server.Timeout,
 		},
+		spool:   spool,
+		log:     logging.For(logging.ComponentSender),
+		breaker: newBreaker(cfg.Sender.Breaker.FailureThreshold, cfg.Sender.Breaker.OpenDuration),
+		backoff: backoff{
+			initial:    cfg.Sender.Retry.InitialInterval,
+			max:        cfg.Sender.Retry.MaxInterval,
+			multiplier: cfg.Sender.Retry.Multiplier,
+		},
+	}
+
+	s.SetBatch(cfg.Sender.Batch)
+
+	return s, nil
+}
+
+// SetBatch changes the batching settings. The batch being sent is not
+// affected, the next one uses the new settings.
+func (s *Sender) SetBatch(batch config.Batch) {
+	s.batch.Store(&batch)
+}
+
+// Enqueue writes a resource event to the spool. It is delivered in order by
+// Run once the parent server is reachable.
+func (s *Sender) Enqueue(event types.ResourceEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal event: %w", err)
+	}
+
+	if err := s.spool.Append(payload); err != nil {
+		return fmt.Errorf("failed to spool event: %w", err)
+	}
+	telemetry.SpoolDepth.Set(float64(s.spool.Depth()))
+
+	return nil
+}
+
+// Run drains the spool to the parent server until ctx is cancelled.
+// Transient failures are retried with exponential backoff without
+// advancing, so events are never reordered or skipped. Events the server
+// rejects outright are dropped, resending them would never succeed.
+func (s *Sender) Run(ctx context.Context) error {
+	for {
+		records, err := s.nextBatch(ctx, false)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			s.log.Error("failed to read spool", "error", err)
+			if !sleep(ctx, s.backoff.next(err)) {
+				return ctx.Err()
+			}
+			continue
+		}
+
+		if _, err := s.process(ctx, records); err != nil {
+			// A request cut short by shutdown is left to Drain
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if !sleep(ctx, s.backoff.next(err)) {
+				return ctx.Err()
+			}
+			continue
+		}
+		s.backoff.reset()
+	}
+}
+
+// Drain delivers what is left in the spool until it is empty or ctx ends,
+// and returns how many events it flushed. It must not run concurrently with
+// Run. Whatever it cannot deliver stays spooled for the next start.
+func (s *Sender) Drain(ctx context.Context) (int, error) {
+	flushed := 0
+	for {
+		records, err := s.nextBatch(ctx, true)
+		if err != nil {
+			return flushed, err
+		}
+		if len(records) == 0 {
+			return flushed, nil
+		}
+
+		acked, err := s.process(ctx, records)
+		flushed += acked
+		if err != nil && (ctx.Err() != nil || !sleep(ctx, s.backoff.next(err))) {
+			return flushed, ctx.Err()
+		}
+	}
+}
+
+// process delivers records and acks the ones that no longer need to be
+// retried, returning how many that were. An error means the rest of the
+// records must be retried after a backoff.
+func (s *Sender) process(ctx context.Context, records []spoolRecord) (int, error) {
+	delivered, err := s.deliver(ctx, records)
+	if err != nil && !isRetryable(err) {
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && statusErr.Code == http.StatusRequestEntityTooLarge && len(records) > 1 {
+			s.batchLimit = len(records) / 2
+			s.log.Warn("batch is too large, limiting batch size", "events", len(records), "limit", s.batchLimit)
+			return 0, nil
+		}
+
+		s.log.Warn("dropping events rejected by server", "events", len(records)-delivered, "error", err)
+		telemetry.EventsDropped.WithLabelValues("rejected").Add(float64(len(records) - delivered))
+		delivered, err = len(records), nil
+	}
+
+	if delivered > 0 {
+		s.lastSend.Store(time.Now().UnixNano())
+		if err := s.spool.Ack(records[delivered-1].next); err != nil {
+			s.log.Error("failed to advance spool cursor", "error", err)
+		}
+		telemetry.SpoolDepth.Set(float64(s.spool.Depth()))
+	}
+
+	if err != nil {
+		telemetry.EventsRetried.Add(float64(len(records) - delivered))
+		var statusErr *StatusError
+		switch {
+		case ctx.Err() != nil:
+		case errors.As(err, &statusErr) && authStatus(statusErr.Code):
+			s.log.Error("server rejected the API key, holding spooled events", "events", len(records)-delivered, "status", statusErr.Code)
+		default:
+			s.log.Warn("failed to deliver spooled events, retrying", "events", len(records)-delivered, "error", err)
+		}
+	}
+	return delivered, err
+}
+
+// deliver sends records to the parent server and returns how many of them,
+// counted from the start, no longer need to be retried. A returned error
+// applies to the records after those.
+func (s *Sender) deliver(ctx context.Context, records []spoolRecord) (int, error) {
+	if s.batch.Load().Enabled {
+		return s.sendBatch(ctx, records)
 	}
+
+	if err := s.send(ctx, records[0].data); err != nil {
+		return 0, err
+	}
+	telemetry.EventsSent.Inc()
+	return 1, nil
 }
 
-// SendResourceEvent sends a resource event to the parent server
+// BreakerState returns the state of the circuit breaker guarding the parent server
+func (s *Sender) BreakerState() BreakerState {
+	return s.breaker.State()
+}
+
+// AuthFailed reports whether the parent server rejects the API key. Spooled
+// events are held, not dropped, until it accepts it again.
+func (s *Sender) AuthFailed() bool {
+	return s.breaker.AuthFailed()
+}
+
+// SpoolDepth returns the number of bytes spooled but not yet delivered
+func (s *Sender) SpoolDepth() int64 {
+	return s.spool.Depth()
+}
+
+// LastSend returns when events were last delivered to the parent server,
+// or the zero time if none have been in this process
+func (s *Sender) LastSend() time.Time {
+	nanos := s.lastSend.Load()
+	if nanos == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, nanos)
+}
+
+// Pending returns the number of spooled events not yet delivered
+func (s *Sender) Pending() (int, error) {
+	return s.spool.Pending()
+}
+
+// Close closes the spool
+func (s *Sender) Close() error {
+	if s.zstd != nil {
+		s.zstd.Close()
+	}
+	return s.spool.Close()
+}
+
+// SendResourceEvent sends a resource event to the parent server immediately,
+// bypassing the spool
 func (s *Sender) SendResourceEvent(ctx context.Context, event types.ResourceEvent) error {
 	payload, err := json.Marshal(event)
 	if err != nil {
 		return fmt.Errorf("failed to marshal event: %w", err)
 	}
 
+	return s.send(ctx, payload)
+}
+
+func (s *Sender) send(ctx context.Context, payload []byte) error {
+	resp, err := s.post(ctx, "/api/v1/resources", payload, "")
+	if err != nil {
+		return err
+	}
+	return resp.Body.Close()
+}
+
+// post sends body to path on the parent server, failing fast while the
+// circuit breaker is open. An error status is returned as a *StatusError.
+// The caller must close the response body.
+func (s *Sender) post(ctx context.Context, path string, body []byte, contentEncoding string) (*http.Response, error) {
+	if !s.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
 	req, err := http.NewRequestWithContext(
 		ctx,
 		"POST",
-		fmt.Sprintf("%s/api/v1/resources", s.cfg.API.Server),
-		bytes.NewBuffer(payload),
+		fmt.Sprintf("%s%s", s.cfg.API.Server, path),
+		bytes.NewBuffer(body),
 	)
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	if contentEncoding != "" {
+		req.Header.Set("Content-Encoding", contentEncoding)
+	}
 	req.Header.Set("X-API-Key", s.cfg.API.Key)
 	req.Header.Set("User-Agent", "skyflo-kubernetes-agent")
 
+	telemetry.PayloadBytes.WithLabelValues(path).Observe(float64(len(body)))
+	start := time.Now()
 	resp, err := s.httpClient.Do(req)
+	telemetry.SendDuration.WithLabelValues(path).Observe(time.Since(start).Seconds())
 	if err != nil {
-		return fmt.Errorf("failed to send request: %w", err)
+		err = fmt.Errorf("failed to send request: %w", err)
+		s.breaker.record(err)
+		return nil, err
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("server returned error status: %d", resp.StatusCode)
+		resp.Body.Close()
+		statusErr := newStatusError(resp)
+		s.breaker.record(statusErr)
+		return nil, statusErr
 	}
+	s.breaker.record(nil)
 
-	return nil
+	return resp, nil
+}
+
+// sleep waits for d or until ctx is cancelled, returning false in the latter case
+func sleep(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
 }
@@ -0,0 +1,134 @@
+package sender
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+func newTestSender(t *testing.T, server string) *Sender {
+	t.Helper()
+
+	cfg := &config.Config{}
+	cfg.API.Server = server
+	cfg.Server.Timeout = time.Second * 10
+	cfg.Sender.Spool.Dir = t.TempDir()
+	cfg.Sender.Spool.SegmentBytes = 1 << 20
+	cfg.Sender.Retry.InitialInterval = time.Millisecond
+	cfg.Sender.Retry.MaxInterval = time.Millisecond * 10
+	cfg.Sender.Retry.Multiplier = 2
+	cfg.Sender.Breaker.FailureThreshold = 5
+	cfg.Sender.Breaker.OpenDuration = time.Minute
+
+	s, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+func enqueue(t *testing.T, s *Sender, n int) {
+	t.Helper()
+	for i := 0; i < n; i++ {
+		if err := s.Enqueue(types.ResourceEvent{ClusterName: "test", EventType: types.EventTypeAdd}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func pending(t *testing.T, s *Sender) int {
+	t.Helper()
+	n, err := s.Pending()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestRunCancelKeepsSpool(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(time.Second)
+	}))
+	defer server.Close()
+
+	s := newTestSender(t, server.URL)
+	enqueue(t, s, 3)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(time.Millisecond*200, cancel)
+	s.Run(ctx)
+
+	if n := pending(t, s); n != 3 {
+		t.Fatalf("pending = %d after cancelling Run mid-request, want 3", n)
+	}
+}
+
+func TestRejectedAPIKeyKeepsSpool(t *testing.T) {
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	s := newTestSender(t, server.URL)
+	enqueue(t, s, 3)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	s.Run(ctx)
+
+	if n := pending(t, s); n != 3 {
+		t.Fatalf("pending = %d after the API key was rejected, want 3", n)
+	}
+	if n := requests.Load(); n != 1 {
+		t.Errorf("server got %d requests, want 1 until the breaker lets a probe through", n)
+	}
+	if !s.AuthFailed() || s.BreakerState() != BreakerOpen {
+		t.Errorf("AuthFailed = %v, breaker %s, want true and open", s.AuthFailed(), s.BreakerState())
+	}
+}
+
+func TestErrorStatus(t *testing.T) {
+	tests := []struct {
+		status      int
+		wantPending int
+		wantBreaker BreakerState
+	}{
+		{http.StatusInternalServerError, 3, BreakerOpen},
+		{http.StatusRequestTimeout, 3, BreakerOpen},
+		{http.StatusServiceUnavailable, 3, BreakerOpen},
+		{http.StatusBadRequest, 0, BreakerClosed},
+		{http.StatusUnprocessableEntity, 0, BreakerClosed},
+	}
+
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			s := newTestSender(t, server.URL)
+			enqueue(t, s, 3)
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+			defer cancel()
+			s.Run(ctx)
+
+			if n := pending(t, s); n != test.wantPending {
+				t.Errorf("pending = %d after status %d, want %d", n, test.status, test.wantPending)
+			}
+			if state := s.BreakerState(); state != test.wantBreaker {
+				t.Errorf("breaker %s after status %d, want %s", state, test.status, test.wantBreaker)
+			}
+		})
+	}
+}
@@ -0,0 +1,462 @@
+package sender
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/telemetry"
+)
+
+const (
+	segmentPrefix = "segment-"
+	segmentSuffix = ".log"
+	cursorFile    = "cursor"
+)
+
+// SpoolOptions configures the on-disk spool
+type SpoolOptions struct {
+	Dir          string
+	MaxBytes     int64
+	MaxAge       time.Duration
+	SegmentBytes int64
+}
+
+// spoolCursor is a read position inside the spool
+type spoolCursor struct {
+	segment uint64
+	offset  int64
+}
+
+type segment struct {
+	id      uint64
+	size    int64
+	modTime time.Time
+}
+
+// Spool is a write-ahead log of encoded events stored as newline-delimited
+// segment files. Records are appended at the tail and read back in order
+// from a persisted cursor, so nothing is lost across backend outages or
+// agent restarts unless the size or age caps force old segments out.
+type Spool struct {
+	opts SpoolOptions
+
+	mu       sync.Mutex
+	segments []segment
+	writer   *os.File
+	cursor   spoolCursor
+	dropped  uint64
+	notify   chan struct{}
+}
+
+// OpenSpool opens (or creates) the spool in opts.Dir and restores the
+// read cursor from a previous run
+func OpenSpool(opts SpoolOptions) (*Spool, error) {
+	if err := os.MkdirAll(opts.Dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create spool directory: %w", err)
+	}
+
+	s := &Spool{
+		opts:   opts,
+		notify: make(chan struct{}, 1),
+	}
+
+	if err := s.loadSegments(); err != nil {
+		return nil, err
+	}
+	if err := s.loadCursor(); err != nil {
+		return nil, err
+	}
+	if err := s.repairTail(); err != nil {
+		return nil, err
+	}
+	if err := s.openWriter(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Append writes a single record to the tail of the spool
+func (s *Spool) Append(record []byte) error {
+	if bytes.IndexByte(record, '\n') >= 0 {
+		return fmt.Errorf("spool record must not contain newlines")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tail := &s.segments[len(s.segments)-1]
+	if tail.size > 0 && tail.size+int64(len(record))+1 > s.opts.SegmentBytes {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+		tail = &s.segments[len(s.segments)-1]
+	}
+
+	line := make([]byte, 0, len(record)+1)
+	line = append(append(line, record...), '\n')
+	n, err := s.writer.Write(line)
+	tail.size += int64(n)
+	tail.modTime = time.Now()
+	if err != nil {
+		return fmt.Errorf("failed to write spool record: %w", err)
+	}
+
+	s.enforceLimits()
+
+	select {
+	case s.notify <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// spoolRecord is a record read from the spool together with the cursor
+// pointing just past it
+type spoolRecord struct {
+	data []byte
+	next spoolCursor
+}
+
+// Peek returns up to max records starting at the read cursor without
+// consuming them. Pass a record's next cursor to Ack once it and every
+// record before it have been delivered.
+func (s *Spool) Peek(max int) ([]spoolRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.enforceLimits()
+
+	var records []spoolRecord
+	cur := s.cursor
+	for len(records) < max {
+		idx := s.segmentIndex(cur.segment)
+		if idx < 0 {
+			break
+		}
+		seg := s.segments[idx]
+		if cur.offset >= seg.size {
+			if idx == len(s.segments)-1 {
+				break
+			}
+			cur = spoolCursor{segment: s.segments[idx+1].id}
+			continue
+		}
+
+		batch, err := s.readSegment(cur, max-len(records))
+		if err != nil {
+			return nil, err
+		}
+		if len(batch) == 0 {
+			if idx == len(s.segments)-1 {
+				// Partial trailing record, wait for the writer to finish it
+				break
+			}
+			cur = spoolCursor{segment: s.segments[idx+1].id}
+			continue
+		}
+		records = append(records, batch...)
+		cur = batch[len(batch)-1].next
+	}
+
+	return records, nil
+}
+
+// Ack advances the read cursor to cur and removes fully consumed segments
+func (s *Spool) Ack(cur spoolCursor) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.segmentIndex(cur.segment) < 0 {
+		// The segment was evicted by the size or age caps while the
+		// records were in flight, the cursor has already moved past it
+		return nil
+	}
+
+	s.cursor = cur
+	for len(s.segments) > 1 && s.segments[0].id < s.cursor.segment {
+		if err := os.Remove(s.segmentPath(s.segments[0].id)); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to remove spool segment: %w", err)
+		}
+		s.segments = s.segments[1:]
+	}
+
+	return s.saveCursor()
+}
+
+// Notify returns a channel that receives a value whenever a record is appended
+func (s *Spool) Notify() <-chan struct{} {
+	return s.notify
+}
+
+// Depth returns the number of bytes waiting to be delivered
+func (s *Spool) Depth() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var depth int64
+	for _, seg := range s.segments {
+		switch {
+		case seg.id == s.cursor.segment:
+			depth += seg.size - s.cursor.offset
+		case seg.id > s.cursor.segment:
+			depth += seg.size
+		}
+	}
+	return depth
+}
+
+// Pending returns the number of records waiting to be delivered. It reads
+// the spool from the cursor on, so it is meant for reporting, not polling.
+func (s *Spool) Pending() (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	pending := 0
+	for _, seg := range s.segments {
+		if seg.id < s.cursor.segment {
+			continue
+		}
+
+		f, err := os.Open(s.segmentPath(seg.id))
+		if err != nil {
+			return 0, fmt.Errorf("failed to open spool segment: %w", err)
+		}
+		if seg.id == s.cursor.segment {
+			if _, err := f.Seek(s.cursor.offset, io.SeekStart); err != nil {
+				f.Close()
+				return 0, fmt.Errorf("failed to seek spool segment: %w", err)
+			}
+		}
+
+		buf := make([]byte, 64<<10)
+		for {
+			n, err := f.Read(buf)
+			pending += bytes.Count(buf[:n], []byte{'\n'})
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				f.Close()
+				return 0, fmt.Errorf("failed to read spool segment: %w", err)
+			}
+		}
+		f.Close()
+	}
+	return pending, nil
+}
+
+// Dropped returns the number of segments evicted by the size or age caps
+func (s *Spool) Dropped() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.dropped
+}
+
+// Close flushes and closes the active segment
+func (s *Spool) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.writer.Sync(); err != nil {
+		return fmt.Errorf("failed to sync spool segment: %w", err)
+	}
+	return s.writer.Close()
+}
+
+func (s *Spool) loadSegments() error {
+	entries, err := os.ReadDir(s.opts.Dir)
+	if err != nil {
+		return fmt.Errorf("failed to read spool directory: %w", err)
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, segmentPrefix) || !strings.HasSuffix(name, segmentSuffix) {
+			continue
+		}
+		id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, segmentPrefix), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return fmt.Errorf("failed to stat spool segment: %w", err)
+		}
+		s.segments = append(s.segments, segment{id: id, size: info.Size(), modTime: info.ModTime()})
+	}
+
+	sort.Slice(s.segments, func(i, j int) bool {
+		return s.segments[i].id < s.segments[j].id
+	})
+
+	if len(s.segments) == 0 {
+		s.segments = append(s.segments, segment{id: 1, modTime: time.Now()})
+	}
+
+	return nil
+}
+
+func (s *Spool) loadCursor() error {
+	s.cursor = spoolCursor{segment: s.segments[0].id}
+
+	data, err := os.ReadFile(filepath.Join(s.opts.Dir, cursorFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read spool cursor: %w", err)
+	}
+
+	var cur spoolCursor
+	if _, err := fmt.Sscanf(string(data), "%d %d", &cur.segment, &cur.offset); err != nil {
+		// A corrupt cursor replays from the oldest segment rather than
+		// skipping data, the backend tolerates duplicates
+		return nil
+	}
+	if s.segmentIndex(cur.segment) >= 0 {
+		s.cursor = cur
+	}
+
+	return nil
+}
+
+func (s *Spool) saveCursor() error {
+	path := filepath.Join(s.opts.Dir, cursorFile)
+	tmp := path + ".tmp"
+	data := fmt.Sprintf("%d %d\n", s.cursor.segment, s.cursor.offset)
+	if err := os.WriteFile(tmp, []byte(data), 0o640); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write spool cursor: %w", err)
+	}
+	return nil
+}
+
+// repairTail truncates a record left half-written by a crash so that new
+// appends do not get glued onto it
+func (s *Spool) repairTail() error {
+	tail := &s.segments[len(s.segments)-1]
+	if tail.size == 0 {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.segmentPath(tail.id))
+	if err != nil {
+		return fmt.Errorf("failed to read spool segment: %w", err)
+	}
+	valid := int64(bytes.LastIndexByte(data, '\n') + 1)
+	if valid == int64(len(data)) {
+		return nil
+	}
+
+	if err := os.Truncate(s.segmentPath(tail.id), valid); err != nil {
+		return fmt.Errorf("failed to truncate spool segment: %w", err)
+	}
+	tail.size = valid
+	if s.cursor.segment == tail.id && s.cursor.offset > valid {
+		s.cursor.offset = valid
+	}
+	return nil
+}
+
+func (s *Spool) openWriter() error {
+	tail := &s.segments[len(s.segments)-1]
+	f, err := os.OpenFile(s.segmentPath(tail.id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	s.writer = f
+	return nil
+}
+
+func (s *Spool) rotate() error {
+	if err := s.writer.Close(); err != nil {
+		return fmt.Errorf("failed to close spool segment: %w", err)
+	}
+	next := s.segments[len(s.segments)-1].id + 1
+	s.segments = append(s.segments, segment{id: next, modTime: time.Now()})
+	return s.openWriter()
+}
+
+// enforceLimits evicts the oldest segments while the spool exceeds its size
+// cap or they are older than the age cap. The active segment is never evicted.
+func (s *Spool) enforceLimits() {
+	var total int64
+	for _, seg := range s.segments {
+		total += seg.size
+	}
+
+	cutoff := time.Now().Add(-s.opts.MaxAge)
+	for len(s.segments) > 1 {
+		oldest := s.segments[0]
+		overSize := s.opts.MaxBytes > 0 && total > s.opts.MaxBytes
+		overAge := s.opts.MaxAge > 0 && oldest.modTime.Before(cutoff)
+		if !overSize && !overAge {
+			break
+		}
+
+		_ = os.Remove(s.segmentPath(oldest.id))
+		s.segments = s.segments[1:]
+		total -= oldest.size
+		s.dropped++
+		telemetry.SpoolSegmentsEvicted.Inc()
+
+		if s.cursor.segment <= oldest.id {
+			s.cursor = spoolCursor{segment: s.segments[0].id}
+			_ = s.saveCursor()
+		}
+	}
+}
+
+func (s *Spool) readSegment(cur spoolCursor, max int) ([]spoolRecord, error) {
+	f, err := os.Open(s.segmentPath(cur.segment))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spool segment: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(cur.offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("failed to seek spool segment: %w", err)
+	}
+
+	var records []spoolRecord
+	reader := bufio.NewReader(f)
+	for len(records) < max {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read spool segment: %w", err)
+		}
+		cur.offset += int64(len(line))
+		records = append(records, spoolRecord{data: line[:len(line)-1], next: cur})
+	}
+
+	return records, nil
+}
+
+func (s *Spool) segmentIndex(id uint64) int {
+	for i, seg := range s.segments {
+		if seg.id == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Spool) segmentPath(id uint64) string {
+	return filepath.Join(s.opts.Dir, fmt.Sprintf("%s%020d%s", segmentPrefix, id, segmentSuffix))
+}
@@ -0,0 +1,167 @@
+package sender
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func openTestSpool(t *testing.T, opts SpoolOptions) *Spool {
+	t.Helper()
+
+	if opts.SegmentBytes == 0 {
+		opts.SegmentBytes = 1 << 20
+	}
+	s, err := OpenSpool(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func appendRecords(t *testing.T, s *Spool, from, to int) {
+	t.Helper()
+
+	for i := from; i < to; i++ {
+		if err := s.Append([]byte(fmt.Sprintf("record-%03d", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// peekAll returns every pending record without consuming them
+func peekAll(t *testing.T, s *Spool) []spoolRecord {
+	t.Helper()
+
+	records, err := s.Peek(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, segmentPrefix+"*"+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func expectRecords(t *testing.T, records []spoolRecord, from, to int) {
+	t.Helper()
+
+	if len(records) != to-from {
+		t.Fatalf("got %d records, want %d", len(records), to-from)
+	}
+	for i, record := range records {
+		if want := fmt.Sprintf("record-%03d", from+i); string(record.data) != want {
+			t.Fatalf("record %d is %q, want %q", i, record.data, want)
+		}
+	}
+}
+
+func TestSpoolResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, SpoolOptions{Dir: dir})
+	appendRecords(t, s, 0, 5)
+	records := peekAll(t, s)
+	if err := s.Ack(records[1].next); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// A crash in the middle of an append leaves half a record behind
+	tail := segmentFiles(t, dir)[0]
+	f, err := os.OpenFile(tail, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteString("record-torn"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	s = openTestSpool(t, SpoolOptions{Dir: dir})
+	defer s.Close()
+	expectRecords(t, peekAll(t, s), 2, 5)
+
+	appendRecords(t, s, 5, 6)
+	expectRecords(t, peekAll(t, s), 2, 6)
+	if pending, err := s.Pending(); err != nil || pending != 4 {
+		t.Fatalf("got %d pending records, %v, want 4", pending, err)
+	}
+}
+
+func TestSpoolRotatesSegments(t *testing.T) {
+	dir := t.TempDir()
+
+	// Two records of 11 bytes each fit in a segment
+	s := openTestSpool(t, SpoolOptions{Dir: dir, SegmentBytes: 22})
+	defer s.Close()
+	appendRecords(t, s, 0, 5)
+
+	if files := segmentFiles(t, dir); len(files) != 3 {
+		t.Fatalf("got %d segments, want 3", len(files))
+	}
+	records := peekAll(t, s)
+	expectRecords(t, records, 0, 5)
+
+	// Acking into the last segment removes the ones before it
+	if err := s.Ack(records[len(records)-1].next); err != nil {
+		t.Fatal(err)
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Fatalf("got %d segments after ack, want 1", len(files))
+	}
+	if depth := s.Depth(); depth != 0 {
+		t.Fatalf("got depth %d, want 0", depth)
+	}
+}
+
+func TestSpoolEvictsOverSizeCap(t *testing.T) {
+	dir := t.TempDir()
+
+	// Segments of two records, capped at three segments
+	s := openTestSpool(t, SpoolOptions{Dir: dir, SegmentBytes: 22, MaxBytes: 66})
+	defer s.Close()
+	appendRecords(t, s, 0, 10)
+
+	if files := segmentFiles(t, dir); len(files) != 3 {
+		t.Fatalf("got %d segments, want 3", len(files))
+	}
+	if dropped := s.Dropped(); dropped != 2 {
+		t.Fatalf("got %d dropped segments, want 2", dropped)
+	}
+	// The cursor moves past the evicted segments to the oldest one left
+	expectRecords(t, peekAll(t, s), 4, 10)
+}
+
+func TestSpoolEvictsOverAgeCap(t *testing.T) {
+	dir := t.TempDir()
+
+	s := openTestSpool(t, SpoolOptions{Dir: dir, SegmentBytes: 22})
+	appendRecords(t, s, 0, 4)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().Add(-2 * time.Hour)
+	if err := os.Chtimes(segmentFiles(t, dir)[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	s = openTestSpool(t, SpoolOptions{Dir: dir, SegmentBytes: 22, MaxAge: time.Hour})
+	defer s.Close()
+	expectRecords(t, peekAll(t, s), 2, 4)
+	if dropped := s.Dropped(); dropped != 1 {
+		t.Fatalf("got %d dropped segments, want 1", dropped)
+	}
+}
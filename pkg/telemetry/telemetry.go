@@ -0,0 +1,147 @@
+// Package telemetry holds the Prometheus metrics the agent exposes about
+// itself. They live on a dedicated registry served by Handler.
+package telemetry
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// Namespace prefixes every metric name
+const Namespace = "skyflo_agent"
+
+// Registry is the registry every agent metric is registered on
+var Registry = prometheus.NewRegistry()
+
+var (
+	EventsObserved = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_observed_total",
+		Help:      "Informer notifications handled, by cluster, resource type and event type.",
+	}, []string{"cluster", "resource_type", "event_type"})
+
+	EventsSuppressed = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_suppressed_total",
+		Help:      "Updates not sent because nothing outside the ignored fields changed.",
+	}, []string{"cluster", "resource_type"})
+
+	EventHandlingDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "event_handling_duration_seconds",
+		Help:      "Time spent handling an informer notification. Slow handlers back up the informer queue.",
+		Buckets:   prometheus.ExponentialBuckets(0.0001, 4, 8),
+	}, []string{"cluster", "resource_type"})
+
+	SnapshotDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "snapshot_duration_seconds",
+		Help:      "Time from starting a snapshot of a resource type to spooling its completion marker.",
+		Buckets:   prometheus.ExponentialBuckets(0.1, 2, 12),
+	}, []string{"cluster", "resource_type"})
+
+	SnapshotItems = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "snapshot_items",
+		Help:      "Number of objects in the last snapshot of a resource type.",
+	}, []string{"cluster", "resource_type"})
+
+	WatchRestarts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "watch_restarts_total",
+		Help:      "Watches against the API server that ended with an error and were restarted.",
+	}, []string{"cluster", "resource_type"})
+
+	ResourcesDegraded = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "resources_degraded",
+		Help:      "Informers of a resource type that currently fail to list or watch, one per namespace when namespace-scoped.",
+	}, []string{"cluster", "resource_type"})
+
+	EventsSent = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_sent_total",
+		Help:      "Events accepted by the parent server.",
+	})
+
+	EventsDropped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_dropped_total",
+		Help:      "Events given up on, by reason: rejected by the server or corrupt in the spool.",
+	}, []string{"reason"})
+
+	EventsRetried = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "events_retried_total",
+		Help:      "Events whose delivery failed transiently and will be retried.",
+	})
+
+	SendDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "send_duration_seconds",
+		Help:      "Latency of requests to the parent server, by endpoint.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"endpoint"})
+
+	PayloadBytes = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: Namespace,
+		Name:      "payload_bytes",
+		Help:      "Size of request bodies sent to the parent server, after compression.",
+		Buckets:   prometheus.ExponentialBuckets(256, 4, 10),
+	}, []string{"endpoint"})
+
+	SpoolDepth = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "spool_depth_bytes",
+		Help:      "Bytes spooled to disk but not yet delivered.",
+	})
+
+	SpoolSegmentsEvicted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "spool_segments_evicted_total",
+		Help:      "Spool segments discarded undelivered because the spool hit its size or age cap.",
+	})
+
+	ConfigReloads = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: Namespace,
+		Name:      "config_reloads_total",
+		Help:      "Changes of the config file picked up at runtime, by result: applied or rejected.",
+	}, []string{"result"})
+
+	ConfigLastReload = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: Namespace,
+		Name:      "config_last_reload_timestamp_seconds",
+		Help:      "Unix time the config file was last reloaded successfully.",
+	})
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		EventsObserved,
+		EventsSuppressed,
+		EventHandlingDuration,
+		SnapshotDuration,
+		SnapshotItems,
+		WatchRestarts,
+		ResourcesDegraded,
+		EventsSent,
+		EventsDropped,
+		EventsRetried,
+		SendDuration,
+		PayloadBytes,
+		SpoolDepth,
+		SpoolSegmentsEvicted,
+		ConfigReloads,
+		ConfigLastReload,
+	)
+}
+
+// Handler serves the metrics in Registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
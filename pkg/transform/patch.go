@@ -0,0 +1,173 @@
+package transform
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+// PatchOperation is a single RFC 6902 JSON Patch operation
+type PatchOperation struct {
+	Op    string
+	Path  string
+	Value interface{}
+}
+
+// MarshalJSON leaves out the value of remove operations only, a null value
+// is meaningful for add and replace
+func (op PatchOperation) MarshalJSON() ([]byte, error) {
+	if op.Op == "remove" {
+		return json.Marshal(struct {
+			Op   string `json:"op"`
+			Path string `json:"path"`
+		}{op.Op, op.Path})
+	}
+	return json.Marshal(struct {
+		Op    string      `json:"op"`
+		Path  string      `json:"path"`
+		Value interface{} `json:"value"`
+	}{op.Op, op.Path, op.Value})
+}
+
+// JSONPatch returns the RFC 6902 operations that turn old into new. Lists
+// of equal length are diffed element by element, lists whose length changed
+// are replaced as a whole.
+func JSONPatch(old, new interface{}) []PatchOperation {
+	return appendJSONPatch(nil, "", old, new)
+}
+
+func appendJSONPatch(ops []PatchOperation, pointer string, old, new interface{}) []PatchOperation {
+	switch n := new.(type) {
+	case map[string]interface{}:
+		o, ok := old.(map[string]interface{})
+		if !ok {
+			break
+		}
+		for _, key := range sortedKeys(o) {
+			if _, ok := n[key]; !ok {
+				ops = append(ops, PatchOperation{Op: "remove", Path: pointer + "/" + escapePointer(key)})
+			}
+		}
+		for _, key := range sortedKeys(n) {
+			child := pointer + "/" + escapePointer(key)
+			if value, ok := o[key]; ok {
+				ops = appendJSONPatch(ops, child, value, n[key])
+			} else {
+				ops = append(ops, PatchOperation{Op: "add", Path: child, Value: n[key]})
+			}
+		}
+		return ops
+	case []interface{}:
+		o, ok := old.([]interface{})
+		if !ok || len(o) != len(n) {
+			break
+		}
+		for i := range n {
+			ops = appendJSONPatch(ops, pointer+"/"+strconv.Itoa(i), o[i], n[i])
+		}
+		return ops
+	}
+
+	if reflect.DeepEqual(old, new) {
+		return ops
+	}
+	return append(ops, PatchOperation{Op: "replace", Path: pointer, Value: new})
+}
+
+// MergePatch returns the RFC 7386 JSON merge patch that turns old into new,
+// or nil if they are equal
+func MergePatch(old, new map[string]interface{}) map[string]interface{} {
+	patch := make(map[string]interface{})
+	for key := range old {
+		if _, ok := new[key]; !ok {
+			patch[key] = nil
+		}
+	}
+	for key, value := range new {
+		previous, ok := old[key]
+		if ok && reflect.DeepEqual(previous, value) {
+			continue
+		}
+		o, oldIsMap := previous.(map[string]interface{})
+		n, newIsMap := value.(map[string]interface{})
+		if ok && oldIsMap && newIsMap {
+			patch[key] = MergePatch(o, n)
+			continue
+		}
+		patch[key] = value
+	}
+
+	if len(patch) == 0 {
+		return nil
+	}
+	return patch
+}
+
+// escapePointer escapes a key for use in an RFC 6901 JSON pointer
+func escapePointer(key string) string {
+	return strings.NewReplacer("~", "~0", "/", "~1").Replace(key)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Differ computes the patches attached to UPDATE events
+type Differ struct {
+	format        types.PatchType
+	includeObject bool
+}
+
+// NewDiffer creates a Differ from the patch settings in cfg
+func NewDiffer(cfg *config.Config) (*Differ, error) {
+	format := types.PatchType(cfg.Transform.Patch.Format)
+	switch format {
+	case "", types.PatchTypeJSON, types.PatchTypeMerge:
+	default:
+		return nil, fmt.Errorf("unsupported patch format %q", format)
+	}
+
+	return &Differ{
+		format:        format,
+		includeObject: cfg.Transform.Patch.IncludeObject || format == "",
+	}, nil
+}
+
+// Enabled reports whether UPDATE events carry a patch
+func (d *Differ) Enabled() bool {
+	return d.format != ""
+}
+
+// IncludeObject reports whether UPDATE events still carry the full object
+func (d *Differ) IncludeObject() bool {
+	return d.includeObject
+}
+
+// Diff returns the patch from old to new, based on the resourceVersion of old
+func (d *Differ) Diff(old, new map[string]interface{}) *types.PatchInfo {
+	info := &types.PatchInfo{Type: d.format}
+	if metadata, ok := old["metadata"].(map[string]interface{}); ok {
+		info.BaseResourceVersion, _ = metadata["resourceVersion"].(string)
+	}
+
+	switch d.format {
+	case types.PatchTypeJSON:
+		info.Patch = JSONPatch(old, new)
+	case types.PatchTypeMerge:
+		info.Patch = MergePatch(old, new)
+	default:
+		return nil
+	}
+	return info
+}
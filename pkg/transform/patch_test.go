@@ -0,0 +1,184 @@
+package transform
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// decode decodes a JSON document, so every test gets a fresh copy
+func decode(t *testing.T, s string) interface{} {
+	t.Helper()
+
+	var v interface{}
+	if err := json.Unmarshal([]byte(s), &v); err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+func encode(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	out, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		// patch is the expected operations as JSON
+		patch string
+	}{
+		{
+			name:  "equal objects",
+			old:   `{"a": 1, "b": {"c": [1, 2]}}`,
+			new:   `{"a": 1, "b": {"c": [1, 2]}}`,
+			patch: `null`,
+		},
+		{
+			name:  "replaced value",
+			old:   `{"spec": {"replicas": 1}}`,
+			new:   `{"spec": {"replicas": 3}}`,
+			patch: `[{"op":"replace","path":"/spec/replicas","value":3}]`,
+		},
+		{
+			name:  "added and removed keys in key order",
+			old:   `{"b": 1, "d": 2}`,
+			new:   `{"a": 1, "c": 2}`,
+			patch: `[{"op":"remove","path":"/b"},{"op":"remove","path":"/d"},{"op":"add","path":"/a","value":1},{"op":"add","path":"/c","value":2}]`,
+		},
+		{
+			name:  "added null value",
+			old:   `{}`,
+			new:   `{"a": null}`,
+			patch: `[{"op":"add","path":"/a","value":null}]`,
+		},
+		{
+			name:  "keys escaped in the pointer",
+			old:   `{"metadata": {"labels": {"app.kubernetes.io/name": "a", "x~y": "a"}}}`,
+			new:   `{"metadata": {"labels": {"app.kubernetes.io/name": "b", "x~y": "b"}}}`,
+			patch: `[{"op":"replace","path":"/metadata/labels/app.kubernetes.io~1name","value":"b"},{"op":"replace","path":"/metadata/labels/x~0y","value":"b"}]`,
+		},
+		{
+			name:  "list of equal length diffed by element",
+			old:   `{"containers": [{"image": "a:1"}, {"image": "b:1"}]}`,
+			new:   `{"containers": [{"image": "a:1"}, {"image": "b:2"}]}`,
+			patch: `[{"op":"replace","path":"/containers/1/image","value":"b:2"}]`,
+		},
+		{
+			name:  "grown list replaced",
+			old:   `{"ports": [80]}`,
+			new:   `{"ports": [80, 443]}`,
+			patch: `[{"op":"replace","path":"/ports","value":[80,443]}]`,
+		},
+		{
+			name:  "shrunk list replaced",
+			old:   `{"ports": [80, 443]}`,
+			new:   `{"ports": []}`,
+			patch: `[{"op":"replace","path":"/ports","value":[]}]`,
+		},
+		{
+			name:  "changed type replaced",
+			old:   `{"a": {"b": 1}}`,
+			new:   `{"a": [1]}`,
+			patch: `[{"op":"replace","path":"/a","value":[1]}]`,
+		},
+		{
+			name:  "removed key leaves out the value",
+			old:   `{"status": {"message": "failing"}}`,
+			new:   `{"status": {}}`,
+			patch: `[{"op":"remove","path":"/status/message"}]`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ops := JSONPatch(decode(t, test.old), decode(t, test.new))
+			if got := encode(t, ops); got != test.patch {
+				t.Errorf("got patch %s, want %s", got, test.patch)
+			}
+		})
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		old, new string
+		// patch is the expected merge patch as JSON
+		patch string
+	}{
+		{
+			name:  "equal objects",
+			old:   `{"a": 1, "b": {"c": 2}}`,
+			new:   `{"a": 1, "b": {"c": 2}}`,
+			patch: `null`,
+		},
+		{
+			name:  "changed value",
+			old:   `{"spec": {"replicas": 1, "paused": false}}`,
+			new:   `{"spec": {"replicas": 3, "paused": false}}`,
+			patch: `{"spec":{"replicas":3}}`,
+		},
+		{
+			name:  "removed keys set to null",
+			old:   `{"metadata": {"labels": {"a": "1", "b": "2"}}, "status": {}}`,
+			new:   `{"metadata": {"labels": {"a": "1"}}}`,
+			patch: `{"metadata":{"labels":{"b":null}},"status":null}`,
+		},
+		{
+			name:  "added key",
+			old:   `{"a": 1}`,
+			new:   `{"a": 1, "b": {"c": 2}}`,
+			patch: `{"b":{"c":2}}`,
+		},
+		{
+			name:  "changed list replaced",
+			old:   `{"ports": [80, 443]}`,
+			new:   `{"ports": [80]}`,
+			patch: `{"ports":[80]}`,
+		},
+		{
+			name:  "object replacing a value",
+			old:   `{"a": "b"}`,
+			new:   `{"a": {"b": null}}`,
+			patch: `{"a":{"b":null}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			old := decode(t, test.old).(map[string]interface{})
+			new := decode(t, test.new).(map[string]interface{})
+			if got := encode(t, MergePatch(old, new)); got != test.patch {
+				t.Errorf("got patch %s, want %s", got, test.patch)
+			}
+		})
+	}
+}
+
+func TestEscapePointer(t *testing.T) {
+	tests := []struct {
+		key, want string
+	}{
+		{key: "name", want: "name"},
+		{key: "app.kubernetes.io/name", want: "app.kubernetes.io~1name"},
+		{key: "a~b", want: "a~0b"},
+		// The escape of a slash is not escaped again
+		{key: "~/", want: "~0~1"},
+		{key: "~1", want: "~01"},
+		{key: "", want: ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.key, func(t *testing.T) {
+			if got := escapePointer(test.key); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
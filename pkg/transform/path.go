@@ -0,0 +1,176 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Path addresses fields of an unstructured object. It is written as a dotted
+// JSON path such as status.conditions[*].lastHeartbeatTime, where [*] walks
+// every element of a list (or every value of a map) and keys containing dots
+// are quoted, as in metadata.annotations['kubectl.kubernetes.io/restartedAt'].
+type Path []segment
+
+type segment struct {
+	key      string
+	wildcard bool
+}
+
+// ParsePath parses the textual form of a Path
+func ParsePath(s string) (Path, error) {
+	var path Path
+	rest := strings.TrimPrefix(s, ".")
+	for rest != "" {
+		switch {
+		case strings.HasPrefix(rest, "[*]"):
+			path = append(path, segment{wildcard: true})
+			rest = rest[3:]
+		case strings.HasPrefix(rest, "['"):
+			end := strings.Index(rest, "']")
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated quoted key in path %q", s)
+			}
+			path = append(path, segment{key: rest[2:end]})
+			rest = rest[end+2:]
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			if end == 0 {
+				return nil, fmt.Errorf("empty key in path %q", s)
+			}
+			path = append(path, segment{key: rest[:end]})
+			rest = rest[end:]
+		}
+		rest = strings.TrimPrefix(rest, ".")
+	}
+
+	if len(path) == 0 {
+		return nil, fmt.Errorf("empty path")
+	}
+	return path, nil
+}
+
+// ParsePaths parses a list of paths
+func ParsePaths(paths []string) ([]Path, error) {
+	parsed := make([]Path, 0, len(paths))
+	for _, s := range paths {
+		p, err := ParsePath(s)
+		if err != nil {
+			return nil, err
+		}
+		parsed = append(parsed, p)
+	}
+	return parsed, nil
+}
+
+// Delete removes every field p addresses from obj
+func (p Path) Delete(obj interface{}) {
+	if len(p) == 0 {
+		return
+	}
+	head, tail := p[0], p[1:]
+
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		if head.wildcard {
+			for key, child := range v {
+				if len(tail) == 0 {
+					delete(v, key)
+				} else {
+					tail.Delete(child)
+				}
+			}
+			return
+		}
+		if len(tail) == 0 {
+			delete(v, head.key)
+			return
+		}
+		tail.Delete(v[head.key])
+	case []interface{}:
+		if !head.wildcard {
+			return
+		}
+		for _, child := range v {
+			tail.Delete(child)
+		}
+	}
+}
+
+// Extract returns a copy of the parts of obj that p addresses, keeping the
+// structure leading to them, or nil if p matches nothing
+func (p Path) Extract(obj interface{}) interface{} {
+	if len(p) == 0 {
+		return obj
+	}
+	head, tail := p[0], p[1:]
+
+	switch v := obj.(type) {
+	case map[string]interface{}:
+		out := make(map[string]interface{})
+		for key, child := range v {
+			if !head.wildcard && key != head.key {
+				continue
+			}
+			if extracted := tail.Extract(child); extracted != nil {
+				out[key] = extracted
+			}
+		}
+		if len(out) == 0 {
+			return nil
+		}
+		return out
+	case []interface{}:
+		if !head.wildcard {
+			return nil
+		}
+		out := make([]interface{}, len(v))
+		found := false
+		for i, child := range v {
+			if out[i] = tail.Extract(child); out[i] != nil {
+				found = true
+			} else if _, ok := child.(map[string]interface{}); ok {
+				// Keep list positions aligned without inventing nulls
+				out[i] = map[string]interface{}{}
+			}
+		}
+		if !found {
+			return nil
+		}
+		return out
+	}
+	return nil
+}
+
+// merge deep-merges src into dst and returns the result. Lists are merged
+// element by element, which is what combining Extract results needs.
+func merge(dst, src interface{}) interface{} {
+	switch s := src.(type) {
+	case map[string]interface{}:
+		d, ok := dst.(map[string]interface{})
+		if !ok {
+			return s
+		}
+		for key, value := range s {
+			d[key] = merge(d[key], value)
+		}
+		return d
+	case []interface{}:
+		d, ok := dst.([]interface{})
+		if !ok || len(d) != len(s) {
+			return s
+		}
+		for i := range s {
+			if s[i] != nil {
+				d[i] = merge(d[i], s[i])
+			}
+		}
+		return d
+	}
+	if src == nil {
+		return dst
+	}
+	return src
+}
@@ -0,0 +1,205 @@
+package transform
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePath(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want Path
+		// err is set when the path must be rejected
+		err bool
+	}{
+		{
+			name: "dotted keys",
+			path: "status.phase",
+			want: Path{{key: "status"}, {key: "phase"}},
+		},
+		{
+			name: "leading dot",
+			path: ".status.phase",
+			want: Path{{key: "status"}, {key: "phase"}},
+		},
+		{
+			name: "wildcard",
+			path: "status.conditions[*].lastHeartbeatTime",
+			want: Path{{key: "status"}, {key: "conditions"}, {wildcard: true}, {key: "lastHeartbeatTime"}},
+		},
+		{
+			name: "trailing wildcard",
+			path: "data[*]",
+			want: Path{{key: "data"}, {wildcard: true}},
+		},
+		{
+			name: "quoted key",
+			path: "metadata.annotations['kubectl.kubernetes.io/restartedAt']",
+			want: Path{{key: "metadata"}, {key: "annotations"}, {key: "kubectl.kubernetes.io/restartedAt"}},
+		},
+		{
+			name: "quoted key first",
+			path: "['a.b'].c",
+			want: Path{{key: "a.b"}, {key: "c"}},
+		},
+		{
+			name: "quoted key containing brackets",
+			path: "data['[*]']",
+			want: Path{{key: "data"}, {key: "[*]"}},
+		},
+		{name: "empty", path: "", err: true},
+		{name: "only a dot", path: ".", err: true},
+		{name: "empty key", path: "a..b", err: true},
+		{name: "unterminated quoted key", path: "metadata.annotations['a.b", err: true},
+		{name: "list index", path: "spec.containers[0]", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ParsePath(test.path)
+			if test.err {
+				if err == nil {
+					t.Fatalf("parsed %q as %v, want an error", test.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestExtract(t *testing.T) {
+	tests := []struct {
+		name string
+		obj  string
+		path string
+		// want is the extracted JSON, null if nothing matches
+		want string
+	}{
+		{
+			name: "key",
+			obj:  `{"status": {"phase": "Running", "podIP": "10.0.0.1"}, "spec": {}}`,
+			path: "status.phase",
+			want: `{"status":{"phase":"Running"}}`,
+		},
+		{
+			name: "missing key",
+			obj:  `{"status": {"phase": "Running"}}`,
+			path: "status.reason",
+			want: `null`,
+		},
+		{
+			name: "quoted key",
+			obj:  `{"metadata": {"annotations": {"example.com/team": "a", "other": "b"}}}`,
+			path: "metadata.annotations['example.com/team']",
+			want: `{"metadata":{"annotations":{"example.com/team":"a"}}}`,
+		},
+		{
+			name: "wildcard over a map",
+			obj:  `{"data": {"x": {"v": 1, "w": 2}, "y": {"v": 3}, "z": {"w": 4}}}`,
+			path: "data[*].v",
+			want: `{"data":{"x":{"v":1},"y":{"v":3}}}`,
+		},
+		{
+			name: "wildcard over a list keeps positions",
+			obj:  `{"containers": [{"name": "a", "image": "a:1"}, {"image": "b:1"}, {"name": "c"}]}`,
+			path: "containers[*].name",
+			want: `{"containers":[{"name":"a"},{},{"name":"c"}]}`,
+		},
+		{
+			name: "wildcard over a list of values",
+			obj:  `{"ports": [80, 443]}`,
+			path: "ports[*]",
+			want: `{"ports":[80,443]}`,
+		},
+		{
+			name: "wildcard matching nothing in a list",
+			obj:  `{"containers": [{"image": "a:1"}]}`,
+			path: "containers[*].name",
+			want: `null`,
+		},
+		{
+			name: "key into a list",
+			obj:  `{"containers": [{"name": "a"}]}`,
+			path: "containers.name",
+			want: `null`,
+		},
+		{
+			name: "key into a value",
+			obj:  `{"status": "Running"}`,
+			path: "status.phase",
+			want: `null`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path, err := ParsePath(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := encode(t, path.Extract(decode(t, test.obj))); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestMerge(t *testing.T) {
+	tests := []struct {
+		name     string
+		dst, src string
+		want     string
+	}{
+		{
+			name: "disjoint keys",
+			dst:  `{"metadata": {"name": "a"}}`,
+			src:  `{"metadata": {"namespace": "b"}, "spec": {}}`,
+			want: `{"metadata":{"name":"a","namespace":"b"},"spec":{}}`,
+		},
+		{
+			name: "aligned lists merged by position",
+			dst:  `{"containers": [{"name": "a"}, {}]}`,
+			src:  `{"containers": [{"image": "a:1"}, {"image": "b:1"}]}`,
+			want: `{"containers":[{"image":"a:1","name":"a"},{"image":"b:1"}]}`,
+		},
+		{
+			name: "null list elements keep the destination",
+			dst:  `{"values": [1, 2]}`,
+			src:  `{"values": [null, 3]}`,
+			want: `{"values":[1,3]}`,
+		},
+		{
+			name: "lists of different length replaced",
+			dst:  `{"values": [1, 2]}`,
+			src:  `{"values": [3]}`,
+			want: `{"values":[3]}`,
+		},
+		{
+			name: "value replaced",
+			dst:  `{"a": {"b": 1}}`,
+			src:  `{"a": 2}`,
+			want: `{"a":2}`,
+		},
+		{
+			name: "null source keeps the destination",
+			dst:  `{"a": 1}`,
+			src:  `null`,
+			want: `{"a":1}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := encode(t, merge(decode(t, test.dst), decode(t, test.src))); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"fmt"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/runtime"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+const lastAppliedAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
+
+// identityPaths are kept even when an allow list does not mention them,
+// the backend cannot place an object without them
+var identityPaths = []string{
+	"apiVersion",
+	"kind",
+	"metadata.name",
+	"metadata.namespace",
+	"metadata.uid",
+	"metadata.resourceVersion",
+}
+
+// Slimmer drops fields the backend has no use for from event payloads
+type Slimmer struct {
+	dropManagedFields bool
+	dropLastApplied   bool
+	identity          []Path
+	rules             map[types.ResourceType]fieldRules
+}
+
+type fieldRules struct {
+	allow  []Path
+	deny   []Path
+	ignore []Path
+}
+
+// NewSlimmer creates a Slimmer from the transform settings in cfg
+func NewSlimmer(cfg *config.Config) (*Slimmer, error) {
+	identity, err := ParsePaths(identityPaths)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Slimmer{
+		dropManagedFields: cfg.Transform.DropManagedFields,
+		dropLastApplied:   cfg.Transform.DropLastApplied,
+		identity:          identity,
+		rules:             make(map[types.ResourceType]fieldRules),
+	}
+
+	for resourceType, rule := range cfg.Transform.Rules {
+		allow, err := ParsePaths(rule.Allow)
+		if err != nil {
+			return nil, fmt.Errorf("invalid allow path for %s: %w", resourceType, err)
+		}
+		deny, err := ParsePaths(rule.Deny)
+		if err != nil {
+			return nil, fmt.Errorf("invalid deny path for %s: %w", resourceType, err)
+		}
+		ignore, err := ParsePaths(rule.Ignore)
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore path for %s: %w", resourceType, err)
+		}
+		s.rules[types.ResourceType(resourceType)] = fieldRules{allow: allow, deny: deny, ignore: ignore}
+	}
+
+	return s, nil
+}
+
+// Slim returns obj without the fields the transform settings drop. obj may
+// be modified in place and must not be shared with a cache.
+func (s *Slimmer) Slim(resourceType types.ResourceType, obj map[string]interface{}) map[string]interface{} {
+	if metadata, ok := obj["metadata"].(map[string]interface{}); ok {
+		if s.dropManagedFields {
+			delete(metadata, "managedFields")
+		}
+		if annotations, ok := metadata["annotations"].(map[string]interface{}); ok && s.dropLastApplied {
+			delete(annotations, lastAppliedAnnotation)
+			if len(annotations) == 0 {
+				delete(metadata, "annotations")
+			}
+		}
+	}
+
+	rules, ok := s.rules[resourceType]
+	if !ok {
+		return obj
+	}
+
+	if len(rules.allow) > 0 {
+		var kept interface{} = map[string]interface{}{}
+		for _, path := range append(rules.allow, s.identity...) {
+			if extracted := path.Extract(obj); extracted != nil {
+				kept = merge(kept, extracted)
+			}
+		}
+		obj = kept.(map[string]interface{})
+	}
+
+	for _, path := range rules.deny {
+		path.Delete(obj)
+	}
+
+	return obj
+}
+
+// Changed reports whether two slimmed versions of an object differ outside
+// the ignore paths of their resource type. Neither object is modified.
+func (s *Slimmer) Changed(resourceType types.ResourceType, old, new map[string]interface{}) bool {
+	ignore := s.rules[resourceType].ignore
+	if len(ignore) > 0 {
+		old, new = runtime.DeepCopyJSON(old), runtime.DeepCopyJSON(new)
+		for _, path := range ignore {
+			path.Delete(old)
+			path.Delete(new)
+		}
+	}
+
+	// resourceVersion changes with every write, including the ignored ones
+	return !reflect.DeepEqual(withoutResourceVersion(old), withoutResourceVersion(new))
+}
+
+// withoutResourceVersion returns obj without metadata.resourceVersion,
+// copying only the maps on the way so obj itself is left alone
+func withoutResourceVersion(obj map[string]interface{}) map[string]interface{} {
+	metadata, ok := obj["metadata"].(map[string]interface{})
+	if !ok {
+		return obj
+	}
+
+	out := shallowCopy(obj)
+	metadata = shallowCopy(metadata)
+	delete(metadata, "resourceVersion")
+	out["metadata"] = metadata
+	return out
+}
+
+func shallowCopy(m map[string]interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(m))
+	for key, value := range m {
+		out[key] = value
+	}
+	return out
+}
@@ -0,0 +1,105 @@
+package transform
+
+import (
+	"testing"
+
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/config"
+	"github.com/KaranJagtiani/skyflo-kubernetes-agent/pkg/types"
+)
+
+func TestSlim(t *testing.T) {
+	const lastApplied = `"kubectl.kubernetes.io/last-applied-configuration": "{}"`
+
+	tests := []struct {
+		name         string
+		configure    func(*config.Config)
+		resourceType types.ResourceType
+		obj          string
+		// want is the slimmed object as JSON
+		want string
+	}{
+		{
+			name: "nothing to drop",
+			obj:  `{"kind": "Pod", "metadata": {"name": "p", "managedFields": [{}], "annotations": {` + lastApplied + `}}}`,
+			want: `{"kind":"Pod","metadata":{"annotations":{"kubectl.kubernetes.io/last-applied-configuration":"{}"},"managedFields":[{}],"name":"p"}}`,
+		},
+		{
+			name: "managed fields and last-applied",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.DropManagedFields = true
+				cfg.Transform.DropLastApplied = true
+			},
+			obj:  `{"kind": "Pod", "metadata": {"name": "p", "managedFields": [{}], "annotations": {` + lastApplied + `}}}`,
+			want: `{"kind":"Pod","metadata":{"name":"p"}}`,
+		},
+		{
+			name:      "last-applied next to other annotations",
+			configure: func(cfg *config.Config) { cfg.Transform.DropLastApplied = true },
+			obj:       `{"kind": "Pod", "metadata": {"name": "p", "annotations": {` + lastApplied + `, "team": "a"}}}`,
+			want:      `{"kind":"Pod","metadata":{"annotations":{"team":"a"},"name":"p"}}`,
+		},
+		{
+			name: "allow keeps the identity",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.Rules = map[string]config.FieldRules{"pod": {Allow: []string{"status.phase"}}}
+			},
+			obj:  `{"apiVersion": "v1", "kind": "Pod", "metadata": {"name": "p", "namespace": "n", "uid": "u", "resourceVersion": "1", "labels": {"a": "b"}}, "spec": {"nodeName": "x"}, "status": {"phase": "Running", "podIP": "10.0.0.1"}}`,
+			want: `{"apiVersion":"v1","kind":"Pod","metadata":{"name":"p","namespace":"n","resourceVersion":"1","uid":"u"},"status":{"phase":"Running"}}`,
+		},
+		{
+			name: "allow paths into a list stay aligned",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.Rules = map[string]config.FieldRules{"pod": {Allow: []string{"spec.containers[*].name", "spec.containers[*].image"}}}
+			},
+			obj:  `{"kind": "Pod", "spec": {"containers": [{"name": "a", "image": "a:1", "args": ["x"]}, {"name": "b", "image": "b:1"}]}}`,
+			want: `{"kind":"Pod","spec":{"containers":[{"image":"a:1","name":"a"},{"image":"b:1","name":"b"}]}}`,
+		},
+		{
+			name: "deny",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.Rules = map[string]config.FieldRules{"node": {Deny: []string{"status.images", "status.conditions[*].lastHeartbeatTime"}}}
+			},
+			resourceType: types.TypeNode,
+			obj:          `{"kind": "Node", "status": {"images": [{}], "conditions": [{"type": "Ready", "lastHeartbeatTime": "t"}]}}`,
+			want:         `{"kind":"Node","status":{"conditions":[{"type":"Ready"}]}}`,
+		},
+		{
+			name: "deny after allow",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.Rules = map[string]config.FieldRules{"pod": {Allow: []string{"metadata.labels"}, Deny: []string{"metadata.labels['example.com/hash']"}}}
+			},
+			obj:  `{"kind": "Pod", "metadata": {"name": "p", "labels": {"app": "a", "example.com/hash": "h"}}, "spec": {}}`,
+			want: `{"kind":"Pod","metadata":{"labels":{"app":"a"},"name":"p"}}`,
+		},
+		{
+			name: "rules of another resource type",
+			configure: func(cfg *config.Config) {
+				cfg.Transform.Rules = map[string]config.FieldRules{"node": {Allow: []string{"status"}}}
+			},
+			obj:  `{"kind": "Pod", "spec": {"nodeName": "x"}}`,
+			want: `{"kind":"Pod","spec":{"nodeName":"x"}}`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{}
+			if test.configure != nil {
+				test.configure(cfg)
+			}
+			s, err := NewSlimmer(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resourceType := test.resourceType
+			if resourceType == "" {
+				resourceType = types.TypePod
+			}
+			obj := decode(t, test.obj).(map[string]interface{})
+			if got := encode(t, s.Slim(resourceType, obj)); got != test.want {
+				t.Errorf("got %s, want %s", got, test.want)
+			}
+		})
+	}
+}
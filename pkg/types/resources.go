@@ -2,6 +2,8 @@ package types
 
 import (
 	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
 )
 
 // ResourceType represents the type of Kubernetes resource
@@ -19,6 +21,22 @@ const (
 	TypeSecret      ResourceType = "secret"
 )
 
+// ResourceTypes are the built-in resource types, watched through typed
+// informers
+var ResourceTypes = []ResourceType{
+	TypeNode, TypeNamespace, TypeIngress, TypeService, TypeDeployment,
+	TypeStatefulSet, TypePod, TypeConfigMap, TypeSecret,
+}
+
+// ResourceTypeForGVR derives the resource type of a resource watched through
+// the dynamic client, using the same resource.group form as kubectl
+func ResourceTypeForGVR(gvr schema.GroupVersionResource) ResourceType {
+	if gvr.Group == "" {
+		return ResourceType(gvr.Resource)
+	}
+	return ResourceType(gvr.Resource + "." + gvr.Group)
+}
+
 // EventType represents the type of event
 type EventType string
 
@@ -27,6 +45,17 @@ const (
 	EventTypeAdd     EventType = "ADD"
 	EventTypeUpdate  EventType = "UPDATE"
 	EventTypeDelete  EventType = "DELETE"
+
+	// EventTypeSnapshotComplete marks the end of a chunked INITIAL snapshot
+	EventTypeSnapshotComplete EventType = "SNAPSHOT_COMPLETE"
+
+	// EventTypeStatus reports that a resource type became degraded or
+	// recovered; it carries no payload
+	EventTypeStatus EventType = "STATUS"
+
+	// EventTypeMetrics carries the resource usage samples of nodes or pods
+	// taken by the metrics collector since its previous poll
+	EventTypeMetrics EventType = "METRICS"
 )
 
 // ResourceEvent represents an event for a Kubernetes resource
@@ -37,6 +66,58 @@ type ResourceEvent struct {
 	Timestamp    time.Time         `json:"timestamp"`
 	Payload      interface{}       `json:"payload"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
+	Snapshot     *SnapshotInfo     `json:"snapshot,omitempty"`
+	Patch        *PatchInfo        `json:"patch,omitempty"`
+	Status       *StatusInfo       `json:"status,omitempty"`
+}
+
+// ResourceState is the state of the watch of a resource type
+type ResourceState string
+
+const (
+	ResourceStateHealthy  ResourceState = "healthy"
+	ResourceStateDegraded ResourceState = "degraded"
+)
+
+// StatusInfo is the state a STATUS event reports. A degraded resource type
+// cannot be listed or watched, in Namespace only if it is set, and changes
+// to it are only sent once it is healthy again.
+type StatusInfo struct {
+	State     ResourceState `json:"state"`
+	Namespace string        `json:"namespace,omitempty"`
+	Reason    string        `json:"reason,omitempty"`
+}
+
+// SnapshotInfo ties an INITIAL chunk or a SNAPSHOT_COMPLETE marker to the
+// snapshot it belongs to. ResourceVersion is the newest resourceVersion
+// among the objects in the snapshot; every later event for the resource
+// type is a delta on top of it. ChunkCount, ItemCount and ResourceVersion are only
+// set on the marker. A namespace-scoped agent takes one snapshot per
+// namespace, which then only covers the objects in Namespace.
+type SnapshotInfo struct {
+	ID              string `json:"id"`
+	Namespace       string `json:"namespace,omitempty"`
+	ChunkIndex      int    `json:"chunk_index"`
+	ChunkCount      int    `json:"chunk_count,omitempty"`
+	ItemCount       int    `json:"item_count,omitempty"`
+	ResourceVersion string `json:"resource_version,omitempty"`
+}
+
+// PatchType is the format of the patch carried by an UPDATE event
+type PatchType string
+
+const (
+	PatchTypeJSON  PatchType = "json-patch"
+	PatchTypeMerge PatchType = "merge-patch"
+)
+
+// PatchInfo describes how an object changed in an UPDATE event. The patch
+// applies to the object at BaseResourceVersion; if that is not the version
+// the backend holds, an event was missed and it should ask for a resync.
+type PatchInfo struct {
+	Type                PatchType   `json:"type"`
+	BaseResourceVersion string      `json:"base_resource_version"`
+	Patch               interface{} `json:"patch"`
 }
 
 // ResourceMetadata contains common metadata for resources